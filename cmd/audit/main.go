@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"seg-red-broker/internal/app/store"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: audit verify [logfile]
+
+Checks the hash chain of the audit log and prints the hash of its last entry.
+The log defaults to AUDIT_LOG_FILE, or audit.log in DATA_FOLDER. The hashes are keyed
+with the key in AUDIT_KEYFILE, the one the broker chains the log with; without it the
+check only detects accidental damage. Keeping the printed hash elsewhere and comparing
+it later also detects entries removed from the end.
+`
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "verify" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	_ = godotenv.Load()
+	path := store.AuditLogPath()
+	if len(os.Args) > 2 {
+		path = os.Args[2]
+	}
+
+	key, err := store.AuditKey()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading audit key:", err)
+		os.Exit(1)
+	}
+	if key == nil {
+		fmt.Fprintln(os.Stderr, "Warning: AUDIT_KEYFILE is not set, the hashes are not keyed")
+	}
+
+	result, err := store.VerifyAuditLog(path, key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading audit log:", err)
+		os.Exit(1)
+	}
+	if !result.Valid {
+		fmt.Printf("Audit log tampered at line %d: %s\n", result.Line, result.Error)
+		fmt.Printf("%d entries verified before it, last hash %s\n", result.Entries, result.Head)
+		os.Exit(1)
+	}
+	fmt.Printf("Audit log valid: %d entries, last hash %s\n", result.Entries, result.Head)
+}
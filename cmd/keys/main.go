@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"seg-red-broker/internal/app/kms"
+	"seg-red-broker/internal/app/store"
+
+	"github.com/joho/godotenv"
+)
+
+const usage = `Usage: keys rotate [keyfile]
+       keys retire <keyid> [keyfile]
+
+rotate adds a new master key to the encryption keyfile and makes it the current one.
+A running broker picks the new key up on its next rewrap, after which the data keys
+are no longer wrapped with the old one.
+
+retire removes an old master key from the keyfile, once no document in DATA_FOLDER,
+trashed ones included, has its data key wrapped with it anymore.
+
+The keyfile defaults to ENCRYPTION_KEYFILE and must already exist.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	_ = godotenv.Load()
+	args := os.Args[2:]
+	var keyID string
+	switch os.Args[1] {
+	case "rotate":
+	case "retire":
+		if len(args) == 0 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		keyID, args = args[0], args[1:]
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	keyfile := os.Getenv("ENCRYPTION_KEYFILE")
+	if len(args) > 0 {
+		keyfile = args[0]
+	}
+	if keyfile == "" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	k, err := kms.OpenLocalKMS(keyfile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading keyfile:", err)
+		os.Exit(1)
+	}
+	if keyID != "" {
+		retire(k, keyID)
+		return
+	}
+	id, err := k.Rotate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error rotating master key:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Current master key:", id)
+}
+
+func retire(k *kms.LocalKMS, keyID string) {
+	n, err := store.CountKeyReferences(keyID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading document metadata:", err)
+		os.Exit(1)
+	}
+	if n > 0 {
+		fmt.Fprintf(os.Stderr, "Master key %s still wraps the data keys of %d documents, wait for the broker to rewrap them\n", keyID, n)
+		os.Exit(1)
+	}
+	if err := k.Retire(keyID); err != nil {
+		fmt.Fprintln(os.Stderr, "Error retiring master key:", err)
+		os.Exit(1)
+	}
+	fmt.Println("Retired master key:", keyID)
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"seg-red-broker/internal/app/common"
+	"strings"
+	"time"
+)
+
+// clamdChunkSize is the size of the chunks streamed to clamd, well below its StreamMaxLength
+const clamdChunkSize = 64 << 10
+
+// ClamdClient scans contents with a ClamAV daemon through the clamd INSTREAM command
+type ClamdClient struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdClient creates a ClamdClient for CLAMD_ADDRESS, a unix socket path or a host:port.
+// It returns nil when no address is configured.
+func NewClamdClient() *ClamdClient {
+	address := os.Getenv("CLAMD_ADDRESS")
+	if address == "" {
+		return nil
+	}
+	network := "tcp"
+	if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+	return &ClamdClient{
+		network: network,
+		address: address,
+		timeout: common.GetEnvDuration("CLAMD_TIMEOUT", 30*time.Second),
+	}
+}
+
+// Scan streams r to clamd and returns the name of the signature found, or "" if the content is clean
+func (client *ClamdClient) Scan(r io.Reader) (string, error) {
+	conn, err := net.DialTimeout(client.network, client.address, client.timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(client.timeout)); err != nil {
+		return "", err
+	}
+
+	// The z prefix makes clamd use null terminated commands and replies
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+	// Every chunk is prefixed by its length in network byte order, a zero length ends the stream
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return "", err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !(err == io.EOF && reply != "") {
+		return "", err
+	}
+	return parseClamdReply(strings.TrimRight(reply, "\x00\n"))
+}
+
+// parseClamdReply reads replies like "stream: OK", "stream: Eicar-Signature FOUND" or "... ERROR"
+func parseClamdReply(reply string) (string, error) {
+	result := strings.TrimSpace(strings.TrimPrefix(reply, "stream:"))
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	default:
+		return "", errors.New("clamd: " + result)
+	}
+}
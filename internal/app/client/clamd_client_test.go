@@ -0,0 +1,113 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eicar is the standard antivirus test file
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// startFakeClamd serves the clamd INSTREAM command, finding eicar in the streamed contents
+func startFakeClamd(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeClamd(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func serveFakeClamd(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if cmd, err := r.ReadString(0); err != nil || cmd != "zINSTREAM\x00" {
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+	var content bytes.Buffer
+	for {
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return
+		}
+		if n == 0 {
+			break
+		}
+		if _, err := io.CopyN(&content, r, int64(n)); err != nil {
+			return
+		}
+	}
+	if strings.Contains(content.String(), "EICAR-STANDARD-ANTIVIRUS-TEST-FILE") {
+		conn.Write([]byte("stream: Eicar-Test-Signature FOUND\x00"))
+		return
+	}
+	conn.Write([]byte("stream: OK\x00"))
+}
+
+func newTestClamdClient(t *testing.T, address string) *ClamdClient {
+	t.Setenv("CLAMD_ADDRESS", address)
+	t.Setenv("CLAMD_TIMEOUT", "2s")
+	return NewClamdClient()
+}
+
+func TestClamdScanClean(t *testing.T) {
+	clamd := newTestClamdClient(t, startFakeClamd(t))
+	// Larger than a chunk, to stream several
+	content := strings.Repeat("clean ", clamdChunkSize/3)
+	signature, err := clamd.Scan(strings.NewReader(content))
+	if err != nil || signature != "" {
+		t.Fatalf("Scan = %q, %v, want a clean content", signature, err)
+	}
+}
+
+func TestClamdScanInfected(t *testing.T) {
+	clamd := newTestClamdClient(t, startFakeClamd(t))
+	signature, err := clamd.Scan(strings.NewReader(eicar))
+	if err != nil || signature != "Eicar-Test-Signature" {
+		t.Fatalf("Scan = %q, %v, want Eicar-Test-Signature", signature, err)
+	}
+}
+
+func TestClamdScanUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	clamd := newTestClamdClient(t, address)
+	start := time.Now()
+	if _, err := clamd.Scan(strings.NewReader(eicar)); err == nil {
+		t.Fatal("Scan succeeded without a clamd to reach")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatal("Scan did not give up within the timeout")
+	}
+}
+
+func TestParseClamdReply(t *testing.T) {
+	if _, err := parseClamdReply("INSTREAM size limit exceeded. ERROR"); err == nil {
+		t.Error("an ERROR reply was not reported")
+	}
+	if signature, err := parseClamdReply("stream: Win.Test FOUND"); err != nil || signature != "Win.Test" {
+		t.Errorf("parseClamdReply = %q, %v, want Win.Test", signature, err)
+	}
+}
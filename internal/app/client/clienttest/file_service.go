@@ -0,0 +1,110 @@
+// Package clienttest provides in-memory stand-ins of the services the broker is a client of,
+// for the tests of the packages built on them.
+package clienttest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// FileService is an in-memory file service. It routes on the segments of the decoded path,
+// the strictest a file service can be, so a doc ID with an escaped slash would reach no document.
+type FileService struct {
+	mu    sync.Mutex
+	files map[string]map[string]string
+	// failures are the statuses answered instead, by method and stored doc path
+	failures map[string]int
+}
+
+// StartFileService serves an empty FileService for the duration of a test and points
+// FILE_SERVICE_BASE_URL at it
+func StartFileService(t *testing.T) *FileService {
+	t.Helper()
+	fs := &FileService{files: make(map[string]map[string]string), failures: make(map[string]int)}
+	srv := httptest.NewServer(fs)
+	t.Cleanup(srv.Close)
+	t.Setenv("FILE_SERVICE_BASE_URL", srv.URL)
+	return fs
+}
+
+func (fs *FileService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 2 {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"statusCode": 404, "message": "not found"})
+		return
+	}
+	username, docID := parts[0], parts[1]
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.files[username] == nil {
+		fs.files[username] = make(map[string]string)
+	}
+	if status, ok := fs.failures[r.Method+" "+username+"/"+docID]; ok {
+		writeJSON(w, status, map[string]interface{}{"statusCode": status, "message": http.StatusText(status)})
+		return
+	}
+	docs := fs.files[username]
+	if docID == "_all_docs" {
+		writeJSON(w, http.StatusOK, docs)
+		return
+	}
+	content, exists := docs[docID]
+	switch {
+	case r.Method == http.MethodGet && exists:
+		writeJSON(w, http.StatusOK, map[string]string{"content": content})
+	case r.Method == http.MethodPost && exists:
+		writeJSON(w, http.StatusConflict, map[string]interface{}{"statusCode": 409, "message": "file already exists"})
+	case r.Method == http.MethodPost || (r.Method == http.MethodPut && exists):
+		body, _ := io.ReadAll(r.Body)
+		docs[docID] = string(body)
+		writeJSON(w, http.StatusOK, map[string]int{"size": len(body)})
+	case r.Method == http.MethodDelete && exists:
+		delete(docs, docID)
+		writeJSON(w, http.StatusOK, map[string]string{})
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{"statusCode": 404, "message": "file not found"})
+	}
+}
+
+// Stored returns the content kept under a stored doc ID, if any
+func (fs *FileService) Stored(username, storedID string) (string, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	content, ok := fs.files[username][storedID]
+	return content, ok
+}
+
+// Put replaces the content kept under a stored doc ID, as if it had changed behind the broker
+func (fs *FileService) Put(username, storedID, content string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.files[username] == nil {
+		fs.files[username] = make(map[string]string)
+	}
+	fs.files[username][storedID] = content
+}
+
+// Fail makes the requests with a method on a stored doc ID fail with status, until Recover
+func (fs *FileService) Fail(method, username, storedID string, status int) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.failures[method+" "+username+"/"+storedID] = status
+}
+
+// Recover stops the failures set by Fail
+func (fs *FileService) Recover() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.failures = make(map[string]int)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -7,8 +7,35 @@ import (
 	"os"
 	"seg-red-broker/internal/app/common"
 	"seg-red-broker/internal/app/dao"
+	"strings"
 )
 
+// NestedDocPrefix starts the IDs the file service keeps nested doc IDs under. The file service
+// routes on single path segments, so projects/2024/report.md is stored as
+// _nested-projects~12024~1report.md, with ~ and / escaped as ~0 and ~1.
+const NestedDocPrefix = "_nested-"
+
+var (
+	nestedEscaper   = strings.NewReplacer("~", "~0", "/", "~1")
+	nestedUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+)
+
+// storedDocID returns the ID the file service keeps a document under
+func storedDocID(docID string) string {
+	if !strings.Contains(docID, "/") {
+		return docID
+	}
+	return NestedDocPrefix + nestedEscaper.Replace(docID)
+}
+
+// docIDOf reverts storedDocID
+func docIDOf(storedID string) string {
+	if escaped, ok := strings.CutPrefix(storedID, NestedDocPrefix); ok {
+		return nestedUnescaper.Replace(escaped)
+	}
+	return storedID
+}
+
 // FileClient struct holds the HTTP client and the base URL for the File service
 type FileClient struct {
 	Client *resty.Client
@@ -31,7 +58,7 @@ func NewFileClient() *FileClient {
 func (client *FileClient) GetFile(username, docID string) (*dao.FileContent, error) {
 	resp, err := client.Client.R().
 		SetResult(&dao.FileContent{}).
-		SetPathParams(map[string]string{"username": username, "docID": docID}).
+		SetPathParams(map[string]string{"username": username, "docID": storedDocID(docID)}).
 		Get("/{username}/{docID}")
 	if err != nil {
 		return nil, err
@@ -46,7 +73,7 @@ func (client *FileClient) GetFile(username, docID string) (*dao.FileContent, err
 func (client *FileClient) CreateFile(username, docID string, content []byte) (*dao.FileSize, error) {
 	resp, err := client.Client.R().
 		SetResult(&dao.FileSize{}).
-		SetPathParams(map[string]string{"username": username, "docID": docID}).
+		SetPathParams(map[string]string{"username": username, "docID": storedDocID(docID)}).
 		SetBody(content).
 		Post("/{username}/{docID}")
 	if err != nil {
@@ -62,7 +89,7 @@ func (client *FileClient) CreateFile(username, docID string, content []byte) (*d
 func (client *FileClient) UpdateFile(username, docID string, content []byte) (*dao.FileSize, error) {
 	resp, err := client.Client.R().
 		SetResult(&dao.FileSize{}).
-		SetPathParams(map[string]string{"username": username, "docID": docID}).
+		SetPathParams(map[string]string{"username": username, "docID": storedDocID(docID)}).
 		SetBody(content).
 		Put("/{username}/{docID}")
 	if err != nil {
@@ -77,7 +104,7 @@ func (client *FileClient) UpdateFile(username, docID string, content []byte) (*d
 // DeleteFile sends a request to delete a file in the File service
 func (client *FileClient) DeleteFile(username, docID string) error {
 	resp, err := client.Client.R().
-		SetPathParams(map[string]string{"username": username, "docID": docID}).
+		SetPathParams(map[string]string{"username": username, "docID": storedDocID(docID)}).
 		Delete("/{username}/{docID}")
 	if err != nil {
 		return err
@@ -102,5 +129,9 @@ func (client *FileClient) GetAllUserDocs(username string) (*map[string]string, e
 	if resp.StatusCode() >= 400 {
 		return nil, resp.Error().(*common.APIError)
 	}
-	return resp.Result().(*map[string]string), nil
+	docs := make(map[string]string, len(m))
+	for storedID, content := range m {
+		docs[docIDOf(storedID)] = content
+	}
+	return &docs, nil
 }
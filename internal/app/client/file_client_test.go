@@ -0,0 +1,19 @@
+package client
+
+import "testing"
+
+func TestStoredDocID(t *testing.T) {
+	for docID, stored := range map[string]string{
+		"report.md":               "report.md",
+		"a~b":                     "a~b",
+		"projects/2024/report.md": NestedDocPrefix + "projects~12024~1report.md",
+		"x~1/y~0":                 NestedDocPrefix + "x~01~1y~00",
+	} {
+		if got := storedDocID(docID); got != stored {
+			t.Errorf("storedDocID(%q) = %q, want %q", docID, got, stored)
+		}
+		if got := docIDOf(stored); got != docID {
+			t.Errorf("docIDOf(%q) = %q, want %q", stored, got, docID)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported compression algorithms, named as in Content-Encoding
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// ErrDecodedTooLarge is returned when decompressed content exceeds the allowed size
+var ErrDecodedTooLarge = errors.New("decompressed content exceeds the maximum size")
+
+// IsCompression tells whether algorithm is a supported compression algorithm
+func IsCompression(algorithm string) bool {
+	return algorithm == CompressionGzip || algorithm == CompressionZstd
+}
+
+// NewCompressWriter returns a writer compressing into w. It must be closed to flush the compressed stream.
+func NewCompressWriter(algorithm string, w io.Writer) (io.WriteCloser, error) {
+	switch algorithm {
+	case CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case CompressionZstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, errors.New("unsupported compression " + algorithm)
+}
+
+// Compress compresses content with the given algorithm
+func Compress(algorithm string, content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := NewCompressWriter(algorithm, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(content); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress decompresses r with the given algorithm, reading at most limit decompressed bytes.
+// A limit lower than zero means no limit.
+func Decompress(algorithm string, r io.Reader, limit int64) ([]byte, error) {
+	var decoded io.Reader
+	switch algorithm {
+	case CompressionGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		decoded = gz
+	case CompressionZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		decoded = zr
+	default:
+		return nil, errors.New("unsupported compression " + algorithm)
+	}
+
+	if limit < 0 {
+		return io.ReadAll(decoded)
+	}
+	content, err := io.ReadAll(io.LimitReader(decoded, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, ErrDecodedTooLarge
+	}
+	return content, nil
+}
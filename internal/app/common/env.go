@@ -0,0 +1,37 @@
+package common
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// GetEnvDuration reads a duration such as "24h" from the environment, falling back to def
+func GetEnvDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Warnf("Invalid duration %q for %s, using %s", value, key, def)
+		return def
+	}
+	return d
+}
+
+// GetEnvInt64 reads an integer from the environment, falling back to def
+func GetEnvInt64(key string, def int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Warnf("Invalid integer %q for %s, using %d", value, key, def)
+		return def
+	}
+	return n
+}
@@ -7,12 +7,16 @@ import (
 )
 
 type APIError struct {
-	StatusCode int    `json:"statusCode"`
-	Err        error  `json:"error,omitempty"`
-	Message    string `json:"message"`
+	StatusCode int         `json:"statusCode"`
+	Err        error       `json:"error,omitempty"`
+	Message    string      `json:"message"`
+	Details    interface{} `json:"details,omitempty"`
 }
 
 func (e *APIError) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
 	return e.Err.Error()
 }
 
@@ -26,7 +30,7 @@ func GlobalErrorHandler() gin.HandlerFunc {
 				// Check if it's an APIError
 				var apiErr *APIError
 				if errors.As(e.Err, &apiErr) {
-					c.JSON(apiErr.StatusCode, APIError{StatusCode: apiErr.StatusCode, Message: apiErr.Message})
+					c.JSON(apiErr.StatusCode, APIError{StatusCode: apiErr.StatusCode, Message: apiErr.Message, Details: apiErr.Details})
 					return
 				}
 			}
@@ -65,6 +69,28 @@ func FileCreationMismatch() *APIError {
 	}
 }
 
+func CustomerKeyRequiredError() *APIError {
+	return &APIError{
+		StatusCode: http.StatusForbidden,
+		Message:    "the document is encrypted with a customer key, which must be supplied to read it",
+	}
+}
+
+func CustomerKeyMismatchError() *APIError {
+	return &APIError{
+		StatusCode: http.StatusForbidden,
+		Message:    "the supplied customer key does not match the key the document was encrypted with",
+	}
+}
+
+func QuarantinedError(details interface{}) *APIError {
+	return &APIError{
+		StatusCode: http.StatusForbidden,
+		Message:    "the document has been quarantined by content scanning",
+		Details:    details,
+	}
+}
+
 func BadRequestError(message string) *APIError {
 	return &APIError{
 		StatusCode: http.StatusBadRequest,
@@ -72,6 +98,77 @@ func BadRequestError(message string) *APIError {
 	}
 }
 
+func ForbiddenError(message string) *APIError {
+	return &APIError{
+		StatusCode: http.StatusForbidden,
+		Message:    message,
+	}
+}
+
+func NotFoundError(message string) *APIError {
+	return &APIError{
+		StatusCode: http.StatusNotFound,
+		Message:    message,
+	}
+}
+
+func ConflictError(message string) *APIError {
+	return &APIError{
+		StatusCode: http.StatusConflict,
+		Message:    message,
+	}
+}
+
+func PreconditionRequiredError(message string) *APIError {
+	return &APIError{
+		StatusCode: http.StatusPreconditionRequired,
+		Message:    message,
+	}
+}
+
+func PreconditionFailedError(message string) *APIError {
+	return &APIError{
+		StatusCode: http.StatusPreconditionFailed,
+		Message:    message,
+	}
+}
+
+func PayloadTooLargeError(message string) *APIError {
+	return &APIError{
+		StatusCode: http.StatusRequestEntityTooLarge,
+		Message:    message,
+	}
+}
+
+func InsufficientStorageError(message string) *APIError {
+	return &APIError{
+		StatusCode: http.StatusInsufficientStorage,
+		Message:    message,
+	}
+}
+
+func UnsupportedMediaTypeError(message string) *APIError {
+	return &APIError{
+		StatusCode: http.StatusUnsupportedMediaType,
+		Message:    message,
+	}
+}
+
+func UnprocessableEntityError(message string, details interface{}) *APIError {
+	return &APIError{
+		StatusCode: http.StatusUnprocessableEntity,
+		Message:    message,
+		Details:    details,
+	}
+}
+
+func ServiceUnavailableError(message string) *APIError {
+	return &APIError{
+		StatusCode: http.StatusServiceUnavailable,
+		Message:    message,
+	}
+}
+
 func ForwardError(c *gin.Context, apiError *APIError) {
 	_ = c.Error(apiError)
 }
@@ -84,15 +181,25 @@ func HandleNoRoute() func(c *gin.Context) {
 
 // HandleError abstracts the error handling logic.
 func HandleError(c *gin.Context, err error) {
+	ForwardError(c, ToAPIError(err))
+}
+
+// ToAPIError returns err as an APIError, wrapping it as an internal error if needed
+func ToAPIError(err error) *APIError {
 	var apiErr *APIError
 	if errors.As(err, &apiErr) {
-		ForwardError(c, apiErr)
-		return
+		return apiErr
 	}
 
-	_ = c.Error(&APIError{
+	return &APIError{
 		StatusCode: http.StatusInternalServerError,
 		Err:        err,
 		Message:    err.Error(),
-	})
+	}
+}
+
+// PublicError returns the APIError of err as it is sent to clients, without the wrapped error
+func PublicError(err error) *APIError {
+	apiErr := ToAPIError(err)
+	return &APIError{StatusCode: apiErr.StatusCode, Message: apiErr.Message, Details: apiErr.Details}
 }
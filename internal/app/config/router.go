@@ -2,8 +2,14 @@ package config
 
 import (
 	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"seg-red-broker/internal/app/client"
 	"seg-red-broker/internal/app/common"
 	"seg-red-broker/internal/app/controller"
+	"seg-red-broker/internal/app/kms"
+	"seg-red-broker/internal/app/service"
+	"seg-red-broker/internal/app/store"
 )
 
 func SetupRouter() *gin.Engine {
@@ -13,9 +19,77 @@ func SetupRouter() *gin.Engine {
 	r.NoRoute(common.HandleNoRoute())
 	v1 := r.Group("/api/v1")
 
+	// Services shared by the controllers
+	as := service.NewAuthService(*client.NewAuthClient())
+	fs := service.NewFileService(*client.NewFileClient(), store.NewMetadataStore())
+	if keyfile := os.Getenv("ENCRYPTION_KEYFILE"); keyfile != "" {
+		k, err := kms.NewLocalKMS(keyfile)
+		if err != nil {
+			log.Fatal("Error loading encryption keyfile: ", err)
+		}
+		fs.EnableEncryption(k)
+		log.Warn("Encryption at rest is enabled, documents written from now on are left out of the plain text search index")
+	}
+	ss := service.NewSearchService(fs, store.NewSearchStore())
+	fs.AddListener(ss)
+	changes := service.NewChangeService()
+	fs.AddListener(changes)
+	webhooks := service.NewWebhookService(store.NewWebhookStore())
+	fs.AddListener(webhooks)
+	trash := service.NewTrashService(fs, store.NewTrashStore())
+	fs.EnableTrash(trash)
+	service.NewExpiryService(fs)
+	qs := service.NewQuotaService(fs, store.NewUsageStore(), store.NewQuotaStore())
+	fs.AddValidator(qs)
+	fs.AddListener(qs)
+	qs.EnableTrash(trash)
+	schemas := service.NewSchemaService(store.NewSchemaStore())
+	fs.AddValidator(schemas)
+	// Scanning is the most expensive validation, it runs last
+	fs.AddValidator(service.NewScanService())
+
+	// The audit middleware only applies to the routes registered after it
+	controller.NewAuditController(v1, service.NewAuditService(store.NewAuditStore()), as)
+
 	controller.NewBrokerController(v1)
 
-	controller.NewFileController(v1)
+	controller.NewMetricsController(v1)
+
+	files := controller.NewFileController(v1, fs, as)
+
+	controller.NewFormUploadController(v1, fs, as)
+
+	controller.NewTransferController(files, service.NewTransferService(fs), as)
+
+	controller.NewPatchController(v1, service.NewPatchService(fs), as)
+
+	controller.NewAppendController(files, service.NewAppendService(fs), as)
+
+	controller.NewLabelController(files, fs, as)
+
+	controller.NewWebhookController(v1, webhooks, as)
+
+	controller.NewChangeController(v1, changes, as)
+
+	controller.NewFolderController(v1, service.NewFolderService(fs), as)
+
+	controller.NewTrashController(v1, trash, as)
+
+	controller.NewBulkController(v1, service.NewBulkService(fs), as)
+
+	controller.NewExportController(v1, service.NewExportService(fs), as)
+
+	controller.NewImportController(v1, service.NewImportService(fs), as)
+
+	controller.NewSearchController(v1, ss, as)
+
+	controller.NewUsageController(v1, qs, as)
+
+	controller.NewSchemaController(v1, schemas, as)
+
+	controller.NewScrubController(v1, service.NewScrubService(fs), as)
+
+	controller.NewUploadController(v1, service.NewUploadService(fs, store.NewUploadStore()), as)
 
 	controller.NewAuthController(v1)
 	return r
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AppendControllerImpl struct {
+	aps service.AppendService
+	as  service.AuthService
+}
+
+func NewAppendController(actions DocumentActions, aps service.AppendService, as service.AuthService) *AppendControllerImpl {
+	c := &AppendControllerImpl{aps: aps, as: as}
+	c.RegisterRoutes(actions)
+	return c
+}
+
+type AppendController interface {
+	Append(c *gin.Context)
+}
+
+// RegisterRoutes registers the append action, POST /:username/<doc path>/_append
+func (ac *AppendControllerImpl) RegisterRoutes(actions DocumentActions) {
+	actions.AddAction(http.MethodPost, "_append", ac.Append)
+}
+
+// Append adds the request body at the end of a document. maxSize limits the size of the
+// document and rollover=true starts a new segment instead of rejecting appends over it.
+func (ac *AppendControllerImpl) Append(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, ac.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	_, docID, apiErr := checkParams(c)
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+
+	maxSize, err := strconv.Atoi(c.DefaultQuery("maxSize", "0"))
+	if err != nil {
+		common.ForwardError(c, common.BadRequestError("maxSize must be a number of bytes"))
+		return
+	}
+	rollover, err := strconv.ParseBool(c.DefaultQuery("rollover", "false"))
+	if err != nil {
+		common.ForwardError(c, common.BadRequestError("rollover must be true or false"))
+		return
+	}
+
+	requestBody, apiErr := readBody(c)
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+	// The content type, expiry and labels only apply to the documents the append creates
+	doc := newDocument(c, requestBody)
+	if doc.CustomerKey, apiErr = customerKey(c); apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+	if doc.Metadata.ExpiresAt, apiErr = expiry(c); apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+	if apiErr = documentLabels(c, &doc.Metadata); apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+
+	size, err := ac.aps.Append(username, docID, doc, maxSize, rollover)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, size)
+}
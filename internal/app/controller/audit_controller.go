@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"regexp"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderRequestID identifies a request in the audit log, it is kept if sent by the client or a proxy
+const HeaderRequestID = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Context keys handlers set for the audit log
+const (
+	// auditActorKey is the authenticated user, or the one signing up or logging in
+	auditActorKey = "auditActor"
+	// auditRejectedKey marks requests whose token was missing or rejected
+	auditRejectedKey = "auditRejected"
+	// auditDocActionKey is the document action a request was dispatched to
+	auditDocActionKey = "auditDocAction"
+	// auditDocumentsKey lists the documents a request on many documents read or wrote
+	auditDocumentsKey = "auditDocuments"
+)
+
+// auditedDocument is a document read or written by a request on many documents
+type auditedDocument struct {
+	action string
+	docID  string
+	status int
+}
+
+// documentOperations name the audited requests on documents, by method
+var documentOperations = map[string]string{
+	http.MethodGet:    "document.read",
+	http.MethodPost:   "document.create",
+	http.MethodPut:    "document.update",
+	http.MethodPatch:  "document.patch",
+	http.MethodDelete: "document.delete",
+}
+
+type AuditControllerImpl struct {
+	aus      service.AuditService
+	as       service.AuthService
+	basePath string
+}
+
+// NewAuditController registers the audit log middleware and the admin query route. The middleware
+// only applies to the routes registered after it, so the controller is created before the others.
+func NewAuditController(r *gin.RouterGroup, aus service.AuditService, as service.AuthService) *AuditControllerImpl {
+	c := &AuditControllerImpl{aus: aus, as: as, basePath: r.BasePath()}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type AuditController interface {
+	Audit(c *gin.Context)
+	Query(c *gin.Context)
+}
+
+// RegisterRoutes registers the audit middleware and the route querying the audit log
+func (ac *AuditControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.Use(ac.Audit)
+	router.GET("/_audit", ac.Query)
+}
+
+// Audit records signups, logins, rejected tokens and every authenticated request once it has
+// been handled, with the request ID it also sends back. Requests on many documents, like bulk,
+// import or export, are also recorded once per document they read or wrote.
+func (ac *AuditControllerImpl) Audit(c *gin.Context) {
+	requestID := c.GetHeader(HeaderRequestID)
+	if !requestIDPattern.MatchString(requestID) {
+		requestID = newRequestID()
+	}
+	c.Header(HeaderRequestID, requestID)
+	start := time.Now().UTC()
+
+	c.Next()
+
+	route := strings.TrimPrefix(c.FullPath(), ac.basePath)
+	actor := c.GetString(auditActorKey)
+	entry := dao.AuditEntry{
+		Time:      start,
+		RequestID: requestID,
+		ClientIP:  c.ClientIP(),
+		Actor:     actor,
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Target:    auditTarget(c),
+		Status:    responseStatus(c),
+	}
+	switch {
+	case route == "/signup" || route == "/login":
+		entry.Action, entry.Target = strings.TrimPrefix(route, "/"), actor
+	case c.GetBool(auditRejectedKey):
+		entry.Action = "token.rejected"
+	case actor == "":
+		// Requests that are not authenticated, like the version or the metrics, are not recorded
+		return
+	case strings.HasPrefix(route, "/:username/:doc_id"):
+		entry.Action = documentOperations[c.Request.Method]
+		if action := c.GetString(auditDocActionKey); action != "" {
+			entry.Action = "document." + strings.TrimPrefix(action, "_")
+		}
+	default:
+		entry.Action = c.Request.Method + " " + route
+	}
+	ac.aus.Record(entry)
+
+	value, _ := c.Get(auditDocumentsKey)
+	docs, _ := value.([]auditedDocument)
+	for _, doc := range docs {
+		entry.Action, entry.Target, entry.Status = doc.action, c.Param("username")+"/"+doc.docID, doc.status
+		ac.aus.Record(entry)
+	}
+}
+
+// Query returns the audit entries of a user, a document and a time range, the most recent
+// first. Only the users listed in AUDIT_ADMINS can query the audit log.
+func (ac *AuditControllerImpl) Query(c *gin.Context) {
+	user, err := CheckTokenInput(c, ac.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	if !ac.aus.IsAdmin(user.Username) {
+		common.ForwardError(c, common.ForbiddenError("only administrators can query the audit log"))
+		return
+	}
+
+	q := dao.AuditQuery{User: c.Query("user"), DocID: c.Query("doc")}
+	if q.DocID != "" {
+		docID, apiErr := service.NormalizeDocID(q.DocID)
+		if apiErr != nil {
+			common.ForwardError(c, apiErr)
+			return
+		}
+		q.DocID = docID
+	}
+	for param, t := range map[string]**time.Time{"from": &q.From, "to": &q.To} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				common.ForwardError(c, common.BadRequestError(param+" must be an RFC 3339 time"))
+				return
+			}
+			*t = &parsed
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil || q.Limit < 1 {
+			common.ForwardError(c, common.BadRequestError("limit must be a positive number"))
+			return
+		}
+	}
+
+	entries, err := ac.aus.Query(q)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// auditDocument adds a document to the audit log of a request on many documents, with the
+// action taken on it and its own status
+func auditDocument(c *gin.Context, action, docID string, status int) {
+	value, _ := c.Get(auditDocumentsKey)
+	docs, _ := value.([]auditedDocument)
+	c.Set(auditDocumentsKey, append(docs, auditedDocument{action: action, docID: docID, status: status}))
+}
+
+// auditTarget returns the document a request was about, or the user
+func auditTarget(c *gin.Context) string {
+	username := c.Param("username")
+	if c.Param("doc_id") == "" {
+		return username
+	}
+	docID, apiErr := service.NormalizeDocID(c.Param("doc_id") + c.Param("path"))
+	if apiErr != nil {
+		docID = c.Param("doc_id") + c.Param("path")
+	}
+	return username + "/" + docID
+}
+
+// responseStatus returns the status of the response, including the errors the global error
+// handler has yet to write
+func responseStatus(c *gin.Context) int {
+	if len(c.Errors) == 0 {
+		return c.Writer.Status()
+	}
+	for _, e := range c.Errors {
+		var apiErr *common.APIError
+		if errors.As(e.Err, &apiErr) {
+			return apiErr.StatusCode
+		}
+	}
+	return http.StatusInternalServerError
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
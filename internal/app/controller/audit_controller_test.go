@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"seg-red-broker/internal/app/store"
+	"testing"
+)
+
+func TestAuditEveryDocument(t *testing.T) {
+	b := newTestBroker(t)
+	logFile := filepath.Join(t.TempDir(), "audit.log")
+	keyfile := filepath.Join(t.TempDir(), "audit.key")
+	if err := os.WriteFile(keyfile, bytes.Repeat([]byte("k"), 32), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AUDIT_LOG_FILE", logFile)
+	t.Setenv("AUDIT_KEYFILE", keyfile)
+	aus := service.NewAuditService(store.NewAuditStore())
+	NewAuditController(b.v1, aus, fakeAuth{})
+	files := NewFileController(b.v1, b.fs, fakeAuth{})
+	NewTransferController(files, service.NewTransferService(b.fs), fakeAuth{})
+	NewBulkController(b.v1, service.NewBulkService(b.fs), fakeAuth{})
+	NewFolderController(b.v1, service.NewFolderService(b.fs), fakeAuth{})
+	NewExportController(b.v1, service.NewExportService(b.fs), fakeAuth{})
+	NewImportController(b.v1, service.NewImportService(b.fs), fakeAuth{})
+
+	expectStatus(t, b.do(http.MethodPost, "/ana/_bulk", []byte(`[
+		{"op":"create","docId":"a","content":"1"},
+		{"op":"create","docId":"b/c","content":"2"},
+		{"op":"get","docId":"missing"}
+	]`)), http.StatusOK)
+	expectStatus(t, b.do(http.MethodGet, "/ana/_export", nil), http.StatusOK)
+	expectStatus(t, b.do(http.MethodPost, "/ana/a/_move", []byte(`{"destination":"d"}`)), http.StatusOK)
+	expectStatus(t, b.do(http.MethodDelete, "/ana/_folders/b", nil, HeaderConfirmDelete, "b"), http.StatusOK)
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	w, err := zw.Create("e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, b.do(http.MethodPost, "/ana/_import", archive.Bytes()), http.StatusOK)
+
+	// Each document has the entries of the requests that touched it, most recent first
+	for docID, want := range map[string][]string{
+		"a":       {"document.move", "document.read", "document.create"},
+		"b/c":     {"document.delete", "document.read", "document.create"},
+		"missing": {"document.read"},
+		"d":       {"document.create"},
+		"e":       {"document.create"},
+	} {
+		entries, err := aus.Query(dao.AuditQuery{DocID: docID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var actions []string
+		for _, entry := range entries {
+			actions = append(actions, entry.Action)
+		}
+		if len(actions) != len(want) {
+			t.Fatalf("%s was audited as %v, want %v", docID, actions, want)
+		}
+		for i := range want {
+			if actions[i] != want[i] {
+				t.Fatalf("%s was audited as %v, want %v", docID, actions, want)
+			}
+		}
+		if docID == "missing" && entries[0].Status != http.StatusNotFound {
+			t.Fatalf("the failed read of missing was audited with status %d", entries[0].Status)
+		}
+	}
+
+	key, err := store.AuditKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verification, err := store.VerifyAuditLog(logFile, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verification.Valid || !verification.Keyed {
+		t.Fatalf("verification %+v, want a valid keyed chain", verification)
+	}
+	if verification, err := store.VerifyAuditLog(logFile, bytes.Repeat([]byte("x"), 32)); err != nil || verification.Valid {
+		t.Fatalf("verification with another key %+v, %v, want an invalid chain", verification, err)
+	}
+}
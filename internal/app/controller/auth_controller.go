@@ -40,6 +40,7 @@ func (ac *AuthControllerImpl) Signup(c *gin.Context) {
 		common.HandleError(c, err)
 		return
 	}
+	c.Set(auditActorKey, user.Username)
 
 	// Create user
 	token, err := ac.svc.Signup(user.Username, user.Password)
@@ -58,6 +59,7 @@ func (ac *AuthControllerImpl) Login(c *gin.Context) {
 		common.HandleError(c, err)
 		return
 	}
+	c.Set(auditActorKey, user.Username)
 
 	// Login user
 	token, err := ac.svc.Login(user.Username, user.Password)
@@ -93,14 +95,34 @@ func checkUserInput(c *gin.Context) (*dao.User, error) {
 	return user, nil
 }
 
+// CheckTokenInput checks the token of the request and returns its user, recording both for the audit log
 func CheckTokenInput(c *gin.Context, svc service.AuthService) (*dao.User, error) {
 	token := c.GetHeader("Authorization")
 	if token == "" {
+		c.Set(auditRejectedKey, true)
 		return nil, common.UnauthorizedError("authorization header is required")
 	}
 	user, err := svc.ValidateToken(token)
 	if err != nil {
+		c.Set(auditRejectedKey, true)
 		return nil, err
 	}
+	c.Set(auditActorKey, user.Username)
 	return user, nil
 }
+
+// CheckOwnerInput checks the token and that it belongs to the user in the path
+func CheckOwnerInput(c *gin.Context, svc service.AuthService) (string, error) {
+	user, err := CheckTokenInput(c, svc)
+	if err != nil {
+		return "", err
+	}
+	username := c.Param("username")
+	if username == "" {
+		return "", common.EmptyParamsError("username")
+	}
+	if username != user.Username {
+		return "", common.FileOwnerMismatch()
+	}
+	return username, nil
+}
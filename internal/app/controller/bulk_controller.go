@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bulkAuditActions name the bulk operations in the audit log like the requests on one document
+var bulkAuditActions = map[string]string{
+	service.BulkGet:    "document.read",
+	service.BulkCreate: "document.create",
+	service.BulkUpdate: "document.update",
+	service.BulkDelete: "document.delete",
+}
+
+type BulkControllerImpl struct {
+	bs            service.BulkService
+	as            service.AuthService
+	maxOperations int
+}
+
+func NewBulkController(r *gin.RouterGroup, bs service.BulkService, as service.AuthService) *BulkControllerImpl {
+	c := &BulkControllerImpl{
+		bs:            bs,
+		as:            as,
+		maxOperations: int(common.GetEnvInt64("BULK_MAX_OPERATIONS", 1000)),
+	}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type BulkController interface {
+	Bulk(c *gin.Context)
+}
+
+// RegisterRoutes registers the bulk routes
+func (bc *BulkControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/:username/_bulk", bc.Bulk)
+}
+
+// Bulk runs an array of get, create, update and delete operations, validating the token only once
+func (bc *BulkControllerImpl) Bulk(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, bc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	var ops []dao.BulkOperation
+	if err := c.ShouldBindJSON(&ops); err != nil {
+		common.ForwardError(c, common.BadRequestError("invalid request body"))
+		return
+	}
+	if len(ops) > bc.maxOperations {
+		common.ForwardError(c, common.PayloadTooLargeError("a bulk request accepts at most "+strconv.Itoa(bc.maxOperations)+" operations"))
+		return
+	}
+
+	results := bc.bs.Execute(username, ops)
+	for _, result := range results {
+		if action, ok := bulkAuditActions[result.Op]; ok {
+			auditDocument(c, action, result.DocID, result.Status)
+		}
+	}
+	c.JSON(http.StatusOK, results)
+}
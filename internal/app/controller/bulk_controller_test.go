@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"testing"
+)
+
+func TestBulk(t *testing.T) {
+	b := newTestBroker(t)
+	t.Setenv("BULK_MAX_OPERATIONS", "8")
+	NewBulkController(b.v1, service.NewBulkService(b.fs), fakeAuth{})
+
+	// Operations on the same document run in request order
+	w := b.do(http.MethodPost, "/ana/_bulk", []byte(`[
+		{"op":"create","docId":"a","content":"one"},
+		{"op":"update","docId":"a","content":"/w==","encoding":"base64"},
+		{"op":"get","docId":"a"},
+		{"op":"delete","docId":"a"},
+		{"op":"get","docId":"a"},
+		{"op":"create","docId":"b","content":"two"},
+		{"op":"rename","docId":"b"},
+		{"op":"get","docId":"../b"}
+	]`))
+	expectStatus(t, w, http.StatusOK)
+	var results []dao.BulkResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	statuses := []int{http.StatusOK, http.StatusOK, http.StatusOK, http.StatusOK, http.StatusNotFound, http.StatusOK, http.StatusBadRequest, http.StatusBadRequest}
+	if len(results) != len(statuses) {
+		t.Fatalf("%d results, want one per operation", len(results))
+	}
+	for i, status := range statuses {
+		if results[i].Status != status {
+			t.Errorf("operation %d %s %s has status %d, want %d", i, results[i].Op, results[i].DocID, results[i].Status, status)
+		}
+		// Failures are reported as APIErrors
+		if status != http.StatusOK && (results[i].Error == nil || results[i].Error.StatusCode != status) {
+			t.Errorf("operation %d %s has error %+v, want an APIError with status %d", i, results[i].Op, results[i].Error, status)
+		}
+	}
+	if got := results[2]; got.Content == nil || *got.Content != "/w==" || got.Encoding != service.EncodingBase64 {
+		t.Errorf("binary content read back as %+v, want it base64 encoded", got)
+	}
+	if got := results[0]; got.Size == nil || *got.Size != 3 {
+		t.Errorf("create returned %+v, want the size", got)
+	}
+	if content, ok := b.backend.Stored("ana", "b"); !ok || content != "two" {
+		t.Fatalf("b stored as %q", content)
+	}
+
+	expectStatus(t, b.do(http.MethodPost, "/ana/_bulk", []byte(`[{},{},{},{},{},{},{},{},{}]`)), http.StatusRequestEntityTooLarge)
+	expectStatus(t, b.do(http.MethodPost, "/ana/_bulk", []byte(`{"op":"get"}`)), http.StatusBadRequest)
+	expectStatus(t, b.do(http.MethodPost, "/bob/_bulk", []byte(`[]`)), http.StatusUnauthorized)
+}
@@ -0,0 +1,156 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+type ChangeControllerImpl struct {
+	cs        service.ChangeService
+	as        service.AuthService
+	heartbeat time.Duration
+	upgrader  websocket.Upgrader
+}
+
+func NewChangeController(r *gin.RouterGroup, cs service.ChangeService, as service.AuthService) *ChangeControllerImpl {
+	c := &ChangeControllerImpl{cs: cs, as: as, heartbeat: common.GetEnvDuration("CHANGES_HEARTBEAT", 30*time.Second)}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type ChangeController interface {
+	Changes(c *gin.Context)
+}
+
+// RegisterRoutes registers the change feed route
+func (cc *ChangeControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/:username/_changes", cc.Changes)
+}
+
+// Changes streams the document changes of the user, over a WebSocket if the request asks for
+// an upgrade and as Server-Sent Events otherwise. Clients resume after the event named by the
+// Last-Event-ID header, or the lastEventId query parameter. The token is only read from the
+// Authorization header, which the browser EventSource and WebSocket APIs cannot send, so
+// browsers have to read the events with fetch, or through a proxy adding the header.
+func (cc *ChangeControllerImpl) Changes(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, cc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("lastEventId")
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		cc.streamWebSocket(c, username, lastEventID)
+		return
+	}
+	cc.streamEvents(c, username, lastEventID)
+}
+
+// streamEvents writes the changes as Server-Sent Events, named after their type
+func (cc *ChangeControllerImpl) streamEvents(c *gin.Context, username, lastEventID string) {
+	backlog, changes, cancel := cc.cs.Subscribe(username, lastEventID)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	write := func(event dao.ChangeEvent) bool {
+		data, err := json.Marshal(event)
+		if err == nil {
+			_, err = fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+		c.Writer.Flush()
+		return err == nil
+	}
+	for _, event := range backlog {
+		if !write(event) {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(cc.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-changes:
+			if !ok || !write(event) {
+				return
+			}
+		case <-ticker.C:
+			// Comments keep proxies from closing idle streams
+			if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+// streamWebSocket sends the changes as JSON text messages. Messages from the client are ignored.
+func (cc *ChangeControllerImpl) streamWebSocket(c *gin.Context, username, lastEventID string) {
+	conn, err := cc.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		log.Debug("Error upgrading the change feed to a WebSocket: ", err)
+		return
+	}
+	defer conn.Close()
+
+	backlog, changes, cancel := cc.cs.Subscribe(username, lastEventID)
+	defer cancel()
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, event := range backlog {
+		if err := conn.WriteJSON(event); err != nil {
+			return
+		}
+	}
+	ticker := time.NewTicker(cc.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case event, ok := <-changes:
+			if !ok {
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind"), time.Now().Add(time.Second))
+				return
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(cc.heartbeat)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
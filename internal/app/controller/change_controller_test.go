@@ -0,0 +1,63 @@
+package controller
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"strings"
+	"testing"
+)
+
+func TestChangesResumeAfterLastEventID(t *testing.T) {
+	b := newTestBroker(t)
+	changes := service.NewChangeService()
+	b.fs.AddListener(changes)
+	NewChangeController(b.v1, changes, fakeAuth{})
+	server := httptest.NewServer(b.router)
+	defer server.Close()
+
+	_, events, cancel := changes.Subscribe("ana", "")
+	defer cancel()
+	for _, docID := range []string{"first", "second"} {
+		if _, err := b.fs.CreateFile("ana", docID, &dao.Document{Content: []byte("x")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := <-events
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/ana/_changes", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The token is only taken from the Authorization header
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status %d without a token, want 401", resp.StatusCode)
+	}
+
+	req.Header.Set("Authorization", "ana")
+	req.Header.Set("Last-Event-ID", first.ID)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %s, want text/event-stream", ct)
+	}
+	// Only the event after the last one seen is sent again
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "event: "+service.EventDocumentCreated) || !strings.Contains(lines[2], `"docId":"second"`) {
+		t.Fatalf("resumed with %q, want the creation of second", lines)
+	}
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// readBody reads the request body, decompressing it according to its Content-Encoding.
+// The body as sent is checked against the Content-Digest and Content-MD5 headers, if any.
+func readBody(c *gin.Context) ([]byte, *common.APIError) {
+	checks, apiErr := parseDigests(c)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	var r io.Reader = c.Request.Body
+	if w := digestWriter(checks); w != nil {
+		r = io.TeeReader(r, w)
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding")))
+	var body []byte
+	if encoding == "" || encoding == "identity" {
+		var err error
+		if body, err = io.ReadAll(r); err != nil {
+			return nil, common.BadRequestError("invalid request body")
+		}
+	} else {
+		if !common.IsCompression(encoding) {
+			return nil, common.UnsupportedMediaTypeError("content encoding must be gzip or zstd")
+		}
+		var err error
+		body, err = common.Decompress(encoding, r, common.GetEnvInt64("MAX_DECODED_BODY_SIZE", 256<<20))
+		if errors.Is(err, common.ErrDecodedTooLarge) {
+			return nil, common.PayloadTooLargeError(err.Error())
+		}
+		if err != nil {
+			return nil, common.BadRequestError("invalid " + encoding + " request body")
+		}
+		// The digests cover anything sent after the compressed stream too
+		if len(checks) > 0 {
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				return nil, common.BadRequestError("invalid request body")
+			}
+		}
+	}
+
+	if apiErr := verifyDigests(checks); apiErr != nil {
+		return nil, apiErr
+	}
+	return body, nil
+}
+
+// CompressResponse compresses the successful responses of the following handlers with the
+// best algorithm accepted by the client. Byte range responses are never compressed.
+func CompressResponse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.GetHeader("Range") != "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		cw := &compressWriter{ResponseWriter: original, encoding: encoding}
+		c.Writer = cw
+		defer func() {
+			if err := cw.Close(); err != nil {
+				log.Error("Error closing compressed response: ", err)
+			}
+			// Errors are rendered afterwards by the global handler, uncompressed
+			c.Writer = original
+		}()
+		c.Header("Vary", "Accept-Encoding")
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks zstd or gzip from an Accept-Encoding header, honouring q-values
+func negotiateEncoding(acceptEncoding string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		// On equal weights zstd wins, it is faster and compresses better
+		if common.IsCompression(name) && q > 0 && (q > bestQ || (q == bestQ && name == common.CompressionZstd)) {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter compresses the body of 200 responses, passing any other response through
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	w        io.WriteCloser
+	bypass   bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if code != http.StatusOK {
+		cw.bypass = true
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(data []byte) (int, error) {
+	if cw.bypass {
+		return cw.ResponseWriter.Write(data)
+	}
+	if cw.w == nil {
+		if cw.Status() != http.StatusOK {
+			cw.bypass = true
+			return cw.ResponseWriter.Write(data)
+		}
+		header := cw.Header()
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		// The compressed representation differs from the stored bytes
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		w, err := common.NewCompressWriter(cw.encoding, cw.ResponseWriter)
+		if err != nil {
+			return 0, err
+		}
+		cw.w = w
+	}
+	return cw.w.Write(data)
+}
+
+func (cw *compressWriter) WriteString(s string) (int, error) {
+	return cw.Write([]byte(s))
+}
+
+// Close flushes the compressed stream, if any was started
+func (cw *compressWriter) Close() error {
+	if cw.w == nil {
+		return nil
+	}
+	return cw.w.Close()
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"seg-red-broker/internal/app/client"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"seg-red-broker/internal/app/store"
+	"strings"
+	"testing"
+)
+
+func compressed(t *testing.T, algorithm string, content []byte) []byte {
+	t.Helper()
+	data, err := common.Compress(algorithm, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func decompressed(t *testing.T, algorithm string, data []byte) []byte {
+	t.Helper()
+	content, err := common.Decompress(algorithm, bytes.NewReader(data), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestCompression(t *testing.T) {
+	b := newTestBroker(t)
+	t.Setenv("STORAGE_COMPRESSION", common.CompressionZstd)
+	t.Setenv("STORAGE_COMPRESSION_MIN_SIZE", "64")
+	t.Setenv("MAX_DECODED_BODY_SIZE", "4096")
+	b.fs = service.NewFileService(*client.NewFileClient(), store.NewMetadataStore())
+	NewFileController(b.v1, b.fs, fakeAuth{})
+	text := strings.Repeat("a line of a large text document\n", 64)
+
+	expectStatus(t, b.do(http.MethodPost, "/ana/big", compressed(t, common.CompressionGzip, []byte(text)), "Content-Encoding", "gzip"), http.StatusOK)
+	expectStatus(t, b.do(http.MethodPost, "/ana/small", compressed(t, common.CompressionZstd, []byte("short")), "Content-Encoding", "zstd"), http.StatusOK)
+	// Only the documents over the minimum size are stored compressed
+	if stored, _ := b.backend.Stored("ana", "big"); stored == text || len(stored) >= len(text) {
+		t.Fatalf("big stored in %d bytes, want it compressed", len(stored))
+	}
+	if stored, _ := b.backend.Stored("ana", "small"); stored != "short" {
+		t.Fatalf("small stored as %q, want it as sent", stored)
+	}
+
+	w := b.do(http.MethodGet, "/ana/big", nil, "Accept-Encoding", "gzip;q=0.5, zstd")
+	expectStatus(t, w, http.StatusOK)
+	if w.Header().Get("Content-Encoding") != "zstd" || !strings.HasPrefix(w.Header().Get("ETag"), `W/`) {
+		t.Fatalf("response encoded as %q with ETag %q, want zstd and a weak ETag", w.Header().Get("Content-Encoding"), w.Header().Get("ETag"))
+	}
+	var doc dao.FileContent
+	if err := json.Unmarshal(decompressed(t, common.CompressionZstd, w.Body.Bytes()), &doc); err != nil || doc.Content != text {
+		t.Fatalf("decompressed response %q (%v), want the document", doc.Content, err)
+	}
+	w = b.do(http.MethodGet, "/ana/big", nil)
+	if w.Header().Get("Content-Encoding") != "" || json.Unmarshal(w.Body.Bytes(), &doc) != nil || doc.Content != text {
+		t.Fatalf("response without Accept-Encoding encoded as %q", w.Header().Get("Content-Encoding"))
+	}
+
+	w = b.do(http.MethodGet, "/ana/_all_docs", nil, "Accept-Encoding", "gzip")
+	expectStatus(t, w, http.StatusOK)
+	var docs map[string]string
+	if err := json.Unmarshal(decompressed(t, common.CompressionGzip, w.Body.Bytes()), &docs); err != nil {
+		t.Fatal(err)
+	}
+	if docs["big"] != text || docs["small"] != "short" {
+		t.Fatalf("_all_docs returned %d documents, want both read back as sent", len(docs))
+	}
+
+	expectStatus(t, b.do(http.MethodPut, "/ana/small", []byte("x"), "Content-Encoding", "br"), http.StatusUnsupportedMediaType)
+	expectStatus(t, b.do(http.MethodPut, "/ana/small", []byte("not gzip"), "Content-Encoding", "gzip"), http.StatusBadRequest)
+	bomb := compressed(t, common.CompressionGzip, make([]byte, 1<<20))
+	expectStatus(t, b.do(http.MethodPut, "/ana/small", bomb, "Content-Encoding", "gzip"), http.StatusRequestEntityTooLarge)
+	// Errors are never compressed
+	w = b.do(http.MethodGet, "/ana/missing", nil, "Accept-Encoding", "gzip")
+	expectStatus(t, w, http.StatusNotFound)
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Fatal("an error response was compressed")
+	}
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"seg-red-broker/internal/app/client"
+	"seg-red-broker/internal/app/client/clienttest"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"seg-red-broker/internal/app/store"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeAuth accepts any token as the name of the user it belongs to
+type fakeAuth struct{}
+
+func (fakeAuth) Signup(username, password string) (*dao.Token, error) {
+	return &dao.Token{}, nil
+}
+
+func (fakeAuth) Login(username, password string) (*dao.Token, error) {
+	return &dao.Token{}, nil
+}
+
+func (fakeAuth) ValidateToken(token string) (*dao.User, error) {
+	return &dao.User{Username: token}, nil
+}
+
+// testBroker is a broker router with the services its tests register routes for, backed by a
+// fake file service and a temporary data folder
+type testBroker struct {
+	router  *gin.Engine
+	v1      *gin.RouterGroup
+	fs      *service.FileServiceImpl
+	backend *clienttest.FileService
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	backend := clienttest.StartFileService(t)
+	t.Setenv("DATA_FOLDER", t.TempDir())
+	t.Setenv("STORAGE_COMPRESSION", "")
+	r := gin.New()
+	r.Use(common.GlobalErrorHandler())
+	return &testBroker{
+		router:  r,
+		v1:      r.Group("/api/v1"),
+		fs:      service.NewFileService(*client.NewFileClient(), store.NewMetadataStore()),
+		backend: backend,
+	}
+}
+
+// do sends a request as ana, with the headers given as name and value pairs
+func (b *testBroker) do(method, path string, body []byte, headers ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/v1"+path, bytes.NewReader(body))
+	req.Header.Set("Authorization", "ana")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	b.router.ServeHTTP(w, req)
+	return w
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status %d (%s), want %d", w.Code, w.Body.String(), status)
+	}
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"seg-red-broker/internal/app/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers carrying a customer-supplied encryption key, which must be sent on every request
+// reading or writing a document encrypted with it
+const (
+	HeaderCustomerAlgorithm = "X-Encryption-Customer-Algorithm"
+	HeaderCustomerKey       = "X-Encryption-Customer-Key"
+	HeaderCustomerKeySHA256 = "X-Encryption-Customer-Key-SHA256"
+)
+
+// CustomerAlgorithm is the only algorithm accepted for customer keys
+const CustomerAlgorithm = "AES256"
+
+// customerKey returns the key supplied in the request headers, or nil if none was.
+// The key is base64 encoded and must come with the base64 SHA-256 of its bytes,
+// so that a key mangled on its way is not used to encrypt a document.
+func customerKey(c *gin.Context) ([]byte, *common.APIError) {
+	algorithm := c.GetHeader(HeaderCustomerAlgorithm)
+	encodedKey := c.GetHeader(HeaderCustomerKey)
+	encodedHash := c.GetHeader(HeaderCustomerKeySHA256)
+	if algorithm == "" && encodedKey == "" && encodedHash == "" {
+		return nil, nil
+	}
+	if algorithm != CustomerAlgorithm {
+		return nil, common.BadRequestError(HeaderCustomerAlgorithm + " must be " + CustomerAlgorithm)
+	}
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil || len(key) != 32 {
+		return nil, common.BadRequestError(HeaderCustomerKey + " must be a base64 encoded 256 bit key")
+	}
+	hash, err := base64.StdEncoding.DecodeString(encodedHash)
+	sum := sha256.Sum256(key)
+	if err != nil || subtle.ConstantTimeCompare(hash, sum[:]) != 1 {
+		return nil, common.BadRequestError(HeaderCustomerKeySHA256 + " does not match the supplied key")
+	}
+	return key, nil
+}
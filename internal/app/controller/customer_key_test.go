@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"seg-red-broker/internal/app/common"
+	"strings"
+	"testing"
+)
+
+// customerKeyHeaders returns the headers supplying a key made of the same byte repeated
+func customerKeyHeaders(b byte) []string {
+	key := bytes.Repeat([]byte{b}, 32)
+	sum := sha256.Sum256(key)
+	return []string{
+		HeaderCustomerAlgorithm, CustomerAlgorithm,
+		HeaderCustomerKey, base64.StdEncoding.EncodeToString(key),
+		HeaderCustomerKeySHA256, base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+func expectError(t *testing.T, w *httptest.ResponseRecorder, want *common.APIError) {
+	t.Helper()
+	expectStatus(t, w, want.StatusCode)
+	var got common.APIError
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.Message != want.Message {
+		t.Fatalf("error %s, want %q", w.Body.String(), want.Message)
+	}
+}
+
+func TestCustomerKey(t *testing.T) {
+	b := newTestBroker(t)
+	NewFileController(b.v1, b.fs, fakeAuth{})
+	key, other := customerKeyHeaders(1), customerKeyHeaders(2)
+	expectStatus(t, b.do(http.MethodPost, "/ana/private", []byte("for my eyes only"), key...), http.StatusOK)
+
+	if stored, _ := b.backend.Stored("ana", "private"); strings.Contains(stored, "eyes") {
+		t.Fatalf("the file service got the plaintext %q", stored)
+	}
+	// The key is never kept by the broker
+	err := filepath.WalkDir(os.Getenv("DATA_FOLDER"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if bytes.Contains(data, []byte(key[3])) || bytes.Contains(data, bytes.Repeat([]byte{1}, 32)) {
+			t.Errorf("the customer key was written to %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := b.do(http.MethodGet, "/ana/private", nil, key...)
+	expectStatus(t, w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), "for my eyes only") || w.Header().Get(HeaderCustomerAlgorithm) != CustomerAlgorithm {
+		t.Fatalf("read back %s with the key", w.Body.String())
+	}
+	expectError(t, b.do(http.MethodGet, "/ana/private", nil), common.CustomerKeyRequiredError())
+	expectError(t, b.do(http.MethodGet, "/ana/private", nil, other...), common.CustomerKeyMismatchError())
+	expectError(t, b.do(http.MethodPut, "/ana/private", []byte("overwritten"), "If-Match", `"any"`), common.CustomerKeyRequiredError())
+
+	// A key mangled on its way is refused before it is used
+	mangled := customerKeyHeaders(1)
+	mangled[5] = other[5]
+	expectStatus(t, b.do(http.MethodGet, "/ana/private", nil, mangled...), http.StatusBadRequest)
+	expectStatus(t, b.do(http.MethodGet, "/ana/private", nil, HeaderCustomerAlgorithm, "DES"), http.StatusBadRequest)
+}
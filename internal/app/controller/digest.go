@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"hash"
+	"io"
+	"seg-red-broker/internal/app/common"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderChecksumSHA256 carries the checksum of the content of a document, its hex SHA-256 or,
+// for documents encrypted with a customer key, its hex HMAC-SHA256 keyed by the customer key
+const HeaderChecksumSHA256 = "X-Checksum-SHA256"
+
+// digestCheck is an expected digest of the request body and the hash computing the actual one
+type digestCheck struct {
+	header   string
+	expected []byte
+	hash     hash.Hash
+}
+
+// contentDigestAlgorithms are the RFC 9530 algorithms verified, the others are ignored
+var contentDigestAlgorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// parseDigests reads the digests a client sent for the request body, in a Content-Digest
+// header (RFC 9530) or a Content-MD5 one (RFC 1864). Both refer to the body as sent,
+// before any Content-Encoding is removed.
+func parseDigests(c *gin.Context) ([]digestCheck, *common.APIError) {
+	var checks []digestCheck
+	if header := c.GetHeader("Content-Digest"); header != "" {
+		for _, member := range strings.Split(header, ",") {
+			name, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+			if !ok {
+				return nil, common.BadRequestError("invalid Content-Digest header")
+			}
+			newHash, supported := contentDigestAlgorithms[strings.ToLower(name)]
+			if !supported {
+				continue
+			}
+			// Byte sequences are base64 enclosed in colons
+			if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				return nil, common.BadRequestError("invalid Content-Digest header")
+			}
+			expected, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+			if err != nil {
+				return nil, common.BadRequestError("invalid Content-Digest header")
+			}
+			checks = append(checks, digestCheck{header: "Content-Digest " + name, expected: expected, hash: newHash()})
+		}
+		if len(checks) == 0 {
+			return nil, common.BadRequestError("Content-Digest must use sha-256 or sha-512")
+		}
+	}
+	if header := c.GetHeader("Content-MD5"); header != "" {
+		expected, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header))
+		if err != nil {
+			return nil, common.BadRequestError("invalid Content-MD5 header")
+		}
+		checks = append(checks, digestCheck{header: "Content-MD5", expected: expected, hash: md5.New()})
+	}
+	return checks, nil
+}
+
+// digestWriter returns a writer feeding every hash of the checks, or nil if there are none
+func digestWriter(checks []digestCheck) io.Writer {
+	if len(checks) == 0 {
+		return nil
+	}
+	writers := make([]io.Writer, len(checks))
+	for i := range checks {
+		writers[i] = checks[i].hash
+	}
+	return io.MultiWriter(writers...)
+}
+
+// verifyDigests checks that every hash matches its expected digest
+func verifyDigests(checks []digestCheck) *common.APIError {
+	for _, check := range checks {
+		if subtle.ConstantTimeCompare(check.hash.Sum(nil), check.expected) != 1 {
+			return common.BadRequestError(check.header + " does not match the request body")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"testing"
+)
+
+func TestContentDigest(t *testing.T) {
+	b := newTestBroker(t)
+	NewFileController(b.v1, b.fs, fakeAuth{})
+	content := []byte(`{"a":1}`)
+	sha256Sum := sha256.Sum256(content)
+	sha512Sum := sha512.Sum512(content)
+	md5Sum := md5.Sum(content)
+	otherSum := sha256.Sum256([]byte("other"))
+	sha256Digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sha256Sum[:]) + ":"
+	sha512Digest := "sha-512=:" + base64.StdEncoding.EncodeToString(sha512Sum[:]) + ":"
+	otherDigest := "sha-256=:" + base64.StdEncoding.EncodeToString(otherSum[:]) + ":"
+	expectStatus(t, b.do(http.MethodPost, "/ana/doc", content, "Content-Digest", sha256Digest), http.StatusOK)
+
+	for _, test := range []struct {
+		name   string
+		header string
+		value  string
+		status int
+	}{
+		{"sha-256", "Content-Digest", sha256Digest, http.StatusOK},
+		{"sha-512 and an unknown algorithm", "Content-Digest", "md5=:AAAA:, " + sha512Digest, http.StatusOK},
+		{"Content-MD5", "Content-MD5", base64.StdEncoding.EncodeToString(md5Sum[:]), http.StatusOK},
+		{"mismatched sha-256", "Content-Digest", otherDigest, http.StatusBadRequest},
+		{"one mismatched algorithm", "Content-Digest", sha512Digest + ", " + otherDigest, http.StatusBadRequest},
+		{"mismatched Content-MD5", "Content-MD5", base64.StdEncoding.EncodeToString(make([]byte, md5.Size)), http.StatusBadRequest},
+		{"only unknown algorithms", "Content-Digest", "md5=:AAAA:", http.StatusBadRequest},
+		{"not a byte sequence", "Content-Digest", "sha-256=abc", http.StatusBadRequest},
+		{"not base64", "Content-MD5", "not base64!", http.StatusBadRequest},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			expectStatus(t, b.do(http.MethodPut, "/ana/doc", content, test.header, test.value), test.status)
+		})
+	}
+	// A rejected create stores nothing
+	expectStatus(t, b.do(http.MethodPost, "/ana/other", content, "Content-Digest", otherDigest), http.StatusBadRequest)
+	expectStatus(t, b.do(http.MethodGet, "/ana/other", nil), http.StatusNotFound)
+
+	w := b.do(http.MethodGet, "/ana/doc", nil)
+	expectStatus(t, w, http.StatusOK)
+	if got := w.Header().Get(HeaderChecksumSHA256); got != hex.EncodeToString(sha256Sum[:]) {
+		t.Fatalf("checksum %q, want the SHA-256 of the content", got)
+	}
+}
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers setting when a document expires, either as a date or as a time to live
+const (
+	HeaderExpiresAt = "Expires-At"
+	HeaderTTL       = "X-TTL"
+)
+
+// expiry returns the expiry requested for a document, if any. Expires-At takes an RFC 3339 or
+// HTTP date and X-TTL a number of seconds or a duration such as 90m.
+func expiry(c *gin.Context) (*time.Time, *common.APIError) {
+	expiresAt, ttl := c.GetHeader(HeaderExpiresAt), c.GetHeader(HeaderTTL)
+	if expiresAt != "" && ttl != "" {
+		return nil, common.BadRequestError("only one of " + HeaderExpiresAt + " and " + HeaderTTL + " can be sent")
+	}
+
+	var t time.Time
+	switch {
+	case expiresAt != "":
+		var err error
+		if t, err = time.Parse(time.RFC3339, expiresAt); err != nil {
+			if t, err = http.ParseTime(expiresAt); err != nil {
+				return nil, common.BadRequestError(HeaderExpiresAt + " must be an RFC 3339 or HTTP date")
+			}
+		}
+	case ttl != "":
+		d, err := time.ParseDuration(ttl)
+		if seconds, convErr := strconv.Atoi(ttl); convErr == nil {
+			d, err = time.Duration(seconds)*time.Second, nil
+		}
+		if err != nil || d <= 0 {
+			return nil, common.BadRequestError(HeaderTTL + " must be a positive number of seconds or duration")
+		}
+		t = time.Now().Add(d)
+	default:
+		return nil, nil
+	}
+
+	if !t.After(time.Now()) {
+		return nil, common.BadRequestError("the expiry of a document must be in the future")
+	}
+	t = t.UTC()
+	return &t, nil
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"mime"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// exportMediaTypes maps the accepted media types to archive formats
+var exportMediaTypes = map[string]string{
+	"application/zip":          service.ArchiveZip,
+	"application/gzip":         service.ArchiveTarGz,
+	"application/x-gzip":       service.ArchiveTarGz,
+	"application/x-gtar":       service.ArchiveTarGz,
+	"application/x-tar+gzip":   service.ArchiveTarGz,
+	"application/octet-stream": service.ArchiveZip,
+}
+
+type ExportControllerImpl struct {
+	es service.ExportService
+	as service.AuthService
+}
+
+func NewExportController(r *gin.RouterGroup, es service.ExportService, as service.AuthService) *ExportControllerImpl {
+	c := &ExportControllerImpl{es: es, as: as}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type ExportController interface {
+	Export(c *gin.Context)
+}
+
+// RegisterRoutes registers the export routes
+func (ec *ExportControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/:username/_export", ec.Export)
+}
+
+// Export streams a zip or tar.gz archive with every document of the user
+func (ec *ExportControllerImpl) Export(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, ec.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	format, apiErr := exportFormat(c.Query("format"), c.GetHeader("Accept"))
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+
+	contentType := "application/zip"
+	if format == service.ArchiveTarGz {
+		contentType = "application/gzip"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": username + "-export." + format}))
+	c.Status(http.StatusOK)
+
+	// The status is already sent once streaming starts, so errors can only cut the archive short
+	manifest, err := ec.es.Export(username, format, c.Writer)
+	for _, entry := range manifest.Documents {
+		status := http.StatusOK
+		if entry.Error != nil {
+			status = entry.Error.StatusCode
+		}
+		auditDocument(c, "document.read", entry.DocID, status)
+	}
+	if err != nil {
+		log.Errorf("Export of %s failed: %v", username, err)
+		c.Abort()
+	}
+}
+
+// exportFormat selects the archive format from the format query parameter or the Accept header
+func exportFormat(query, accept string) (string, *common.APIError) {
+	switch query {
+	case service.ArchiveZip, service.ArchiveTarGz:
+		return query, nil
+	case "tgz":
+		return service.ArchiveTarGz, nil
+	case "":
+	default:
+		return "", common.BadRequestError("format must be zip or tar.gz")
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if format, ok := exportMediaTypes[mediaType]; ok {
+			return format, nil
+		}
+	}
+	return service.ArchiveZip, nil
+}
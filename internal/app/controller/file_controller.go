@@ -1,29 +1,43 @@
 package controller
 
 import (
-	"io"
+	"bytes"
+	"mime"
 	"net/http"
-	"seg-red-broker/internal/app/client"
 	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
 	"seg-red-broker/internal/app/service"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Headers describing the verdict of the content scanners on a tagged document
+const (
+	HeaderScanOutcome  = "X-Scan-Outcome"
+	HeaderScanFindings = "X-Scan-Findings"
+)
+
 type FileControllerImpl struct {
 	fs service.FileService
 	as service.AuthService
+	// actions handle the requests on /:username/<doc path>/_<action>, by method and action name
+	actions map[string]gin.HandlerFunc
 }
 
-func NewFileController(r *gin.RouterGroup) *FileControllerImpl {
-	c := &FileControllerImpl{
-		fs: service.NewFileService(*client.NewFileClient()),
-		as: service.NewAuthService(*client.NewAuthClient()),
-	}
+func NewFileController(r *gin.RouterGroup, fs service.FileService, as service.AuthService) *FileControllerImpl {
+	c := &FileControllerImpl{fs: fs, as: as, actions: make(map[string]gin.HandlerFunc)}
 	c.RegisterRoutes(r)
 	return c
 }
 
+// DocumentActions lets other controllers handle requests on /:username/<doc path>/_<action>.
+// These cannot be routes of their own, gin does not allow them next to the catch-all document routes.
+type DocumentActions interface {
+	AddAction(method, action string, handler gin.HandlerFunc)
+}
+
 type FileController interface {
 	GetFile(c *gin.Context)
 	CreateFile(c *gin.Context)
@@ -32,13 +46,43 @@ type FileController interface {
 	GetAllUserDocs(c *gin.Context)
 }
 
-// RegisterRoutes registers the authentication routes
+// RegisterRoutes registers the document routes. Nested doc IDs such as projects/2024/report.md
+// are matched by the catch-all routes, which also dispatch the document actions.
 func (fc *FileControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
-	router.GET("/:username/:doc_id", fc.GetFile)
+	router.GET("/:username/:doc_id", CompressResponse(), fc.GetFile)
 	router.POST("/:username/:doc_id", fc.CreateFile)
 	router.PUT("/:username/:doc_id", fc.UpdateFile)
 	router.DELETE("/:username/:doc_id", fc.DeleteFile)
-	router.GET("/:username/_all_docs", fc.GetAllUserDocs)
+	router.GET("/:username/:doc_id/*path", CompressResponse(), fc.dispatch(http.MethodGet, fc.GetFile))
+	router.POST("/:username/:doc_id/*path", fc.dispatch(http.MethodPost, fc.CreateFile))
+	router.PUT("/:username/:doc_id/*path", fc.dispatch(http.MethodPut, fc.UpdateFile))
+	router.DELETE("/:username/:doc_id/*path", fc.dispatch(http.MethodDelete, fc.DeleteFile))
+	router.GET("/:username/_all_docs", CompressResponse(), fc.GetAllUserDocs)
+}
+
+// AddAction registers the handler of an action on documents, its name starting with an underscore
+func (fc *FileControllerImpl) AddAction(method, action string, handler gin.HandlerFunc) {
+	fc.actions[method+" "+action] = handler
+}
+
+// dispatch runs the action named by the last segment of the path, if there is one registered,
+// with the path param trimmed to the doc ID. Any other request goes to the document handler.
+func (fc *FileControllerImpl) dispatch(method string, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rest := c.Param("path")
+		i := strings.LastIndex(rest, "/")
+		if action, ok := fc.actions[method+" "+rest[i+1:]]; ok {
+			c.Set(auditDocActionKey, rest[i+1:])
+			for p := range c.Params {
+				if c.Params[p].Key == "path" {
+					c.Params[p].Value = rest[:i]
+				}
+			}
+			action(c)
+			return
+		}
+		handler(c)
+	}
 }
 
 func (fc *FileControllerImpl) GetFile(c *gin.Context) {
@@ -62,16 +106,41 @@ func (fc *FileControllerImpl) GetFile(c *gin.Context) {
 		return
 	}
 
+	key, apiErr := customerKey(c)
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+
 	// Get the file from the file service
-	content, err := fc.fs.GetFile(user.Username, docID)
+	doc, err := fc.fs.GetFileWithKey(user.Username, docID, key)
 	if err != nil {
 		common.HandleError(c, err)
 		return
 	}
-
-	// Return the file content
-	c.JSON(http.StatusOK, content)
-
+	if key != nil {
+		c.Header(HeaderCustomerAlgorithm, CustomerAlgorithm)
+	}
+	if doc.Metadata.SHA256 != "" {
+		c.Header(HeaderChecksumSHA256, doc.Metadata.SHA256)
+	}
+	if doc.Metadata.Scan != nil {
+		writeScanHeaders(c, doc.Metadata.Scan)
+	}
+	if doc.Metadata.ExpiresAt != nil {
+		c.Header(HeaderExpiresAt, doc.Metadata.ExpiresAt.Format(time.RFC3339))
+	}
+	writeLabelHeaders(c, &doc.Metadata)
+	// The ETag identifies the content in both representations, for conditional PATCH requests
+	c.Header("ETag", service.ETag(doc))
+
+	// Return the raw bytes if asked for, the JSON envelope otherwise.
+	// Byte ranges always refer to the raw content, never to the envelope.
+	if c.GetHeader("Range") != "" || wantsRawContent(c.GetHeader("Accept"), doc.Metadata.ContentType) {
+		writeRawContent(c, docID, doc)
+		return
+	}
+	c.JSON(http.StatusOK, dao.FileContent{Content: string(doc.Content)})
 }
 func (fc *FileControllerImpl) CreateFile(c *gin.Context) {
 	// Check if the token is valid
@@ -95,13 +164,27 @@ func (fc *FileControllerImpl) CreateFile(c *gin.Context) {
 	}
 
 	//ReadBody
-	requestBody, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		common.ForwardError(c, common.BadRequestError("invalid request body"))
+	requestBody, apiErr := readBody(c)
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+
+	doc := newDocument(c, requestBody)
+	if doc.CustomerKey, apiErr = customerKey(c); apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+	if doc.Metadata.ExpiresAt, apiErr = expiry(c); apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+	if apiErr = documentLabels(c, &doc.Metadata); apiErr != nil {
+		common.ForwardError(c, apiErr)
 		return
 	}
 
-	size, err := fc.fs.CreateFile(user.Username, docID, requestBody)
+	size, err := fc.fs.CreateFile(user.Username, docID, doc)
 	if err != nil {
 		common.HandleError(c, err)
 		return
@@ -131,18 +214,36 @@ func (fc *FileControllerImpl) UpdateFile(c *gin.Context) {
 	}
 
 	//ReadBody
-	requestBody, err := io.ReadAll(c.Request.Body)
-	if err != nil {
-		common.ForwardError(c, common.BadRequestError("invalid request body"))
+	requestBody, apiErr := readBody(c)
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
 		return
 	}
 
+	doc := newDocument(c, requestBody)
+	if doc.CustomerKey, apiErr = customerKey(c); apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+	if doc.Metadata.ExpiresAt, apiErr = expiry(c); apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+	if apiErr = documentLabels(c, &doc.Metadata); apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+
+	// If-Match makes the update conditional on the ETag returned by GetFile
+	doc.IfMatch = c.GetHeader("If-Match")
+
 	// Update the file in the file service
-	size, err := fc.fs.UpdateFile(user.Username, docID, requestBody)
+	size, err := fc.fs.UpdateFile(user.Username, docID, doc)
 	if err != nil {
 		common.HandleError(c, err)
 		return
 	}
+	c.Header("ETag", service.ETag(doc))
 
 	// Return the file size
 	c.JSON(http.StatusOK, size)
@@ -201,7 +302,14 @@ func (fc *FileControllerImpl) GetAllUserDocs(c *gin.Context) {
 		return
 	}
 
-	docs, err := fc.fs.GetAllUserDocs(username)
+	// Documents can be selected by their labels and tags
+	selector, err := service.ParseSelector(c.Query("selector"), c.Query("tags"))
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	docs, err := fc.fs.FindUserDocs(username, selector)
 	if err != nil {
 		common.HandleError(c, err)
 		return
@@ -210,15 +318,66 @@ func (fc *FileControllerImpl) GetAllUserDocs(c *gin.Context) {
 	c.JSON(http.StatusOK, docs)
 }
 
-// checkParams checks if the username and docID are valid
+// checkParams checks if the username and docID are valid. The docID joins the doc_id param
+// with the rest of the path matched by the catch-all routes.
 func checkParams(c *gin.Context) (string, string, *common.APIError) {
 	username := c.Param("username")
 	if username == "" {
 		return "", "", common.EmptyParamsError("username")
 	}
-	docID := c.Param("doc_id")
-	if docID == "" {
-		return "", "", common.EmptyParamsError("doc_id")
+	docID, apiErr := service.NormalizeDocID(c.Param("doc_id") + c.Param("path"))
+	if apiErr != nil {
+		return "", "", apiErr
 	}
 	return username, docID, nil
 }
+
+// newDocument builds the document to store from the request body, keeping its content type
+func newDocument(c *gin.Context, content []byte) *dao.Document {
+	return &dao.Document{
+		Content:  content,
+		Metadata: dao.FileMetadata{ContentType: c.GetHeader("Content-Type")},
+	}
+}
+
+// writeScanHeaders tells the outcome of the content scanners on a tagged document and what they found
+func writeScanHeaders(c *gin.Context, scan *dao.ScanResult) {
+	findings := make([]string, len(scan.Findings))
+	for i, f := range scan.Findings {
+		findings[i] = f.Category + "/" + f.Rule
+	}
+	c.Header(HeaderScanOutcome, scan.Outcome)
+	c.Header(HeaderScanFindings, strings.Join(findings, ", "))
+}
+
+// wantsRawContent checks if the Accept header asks for the document bytes instead of the JSON envelope.
+// application/json keeps selecting the envelope so that existing clients are not affected.
+func wantsRawContent(accept, contentType string) bool {
+	storedType, _, _ := mime.ParseMediaType(contentType)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		if mediaType == "application/octet-stream" {
+			return true
+		}
+		if storedType != "" && mediaType == storedType && mediaType != "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRawContent writes the document bytes with their stored content type.
+// The file service cannot serve byte ranges, so Range and If-Range requests are answered
+// by slicing the content here, including multipart/byteranges and 416 responses.
+func writeRawContent(c *gin.Context, docID string, doc *dao.Document) {
+	contentType := doc.Metadata.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": docID}))
+	http.ServeContent(c.Writer, c.Request, docID, doc.Metadata.UpdatedAt, bytes.NewReader(doc.Content))
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"seg-red-broker/internal/app/dao"
+	"testing"
+)
+
+func TestGetFileRawContent(t *testing.T) {
+	b := newTestBroker(t)
+	NewFileController(b.v1, b.fs, fakeAuth{})
+	png := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe, '\n'}
+	expectStatus(t, b.do(http.MethodPost, "/ana/logo.png", png, "Content-Type", "image/png"), http.StatusOK)
+
+	// The JSON envelope stays the default
+	w := b.do(http.MethodGet, "/ana/logo.png", nil)
+	expectStatus(t, w, http.StatusOK)
+	var envelope dao.FileContent
+	if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("default response %q is not the JSON envelope: %v", w.Body.String(), err)
+	}
+
+	for _, accept := range []string{"application/octet-stream", "image/png", "application/json;q=0.5, image/png"} {
+		w := b.do(http.MethodGet, "/ana/logo.png", nil, "Accept", accept)
+		expectStatus(t, w, http.StatusOK)
+		if !bytes.Equal(w.Body.Bytes(), png) {
+			t.Fatalf("Accept %s returned %q, want the stored bytes", accept, w.Body.Bytes())
+		}
+		for header, want := range map[string]string{
+			"Content-Type":        "image/png",
+			"Content-Length":      "8",
+			"Content-Disposition": `attachment; filename=logo.png`,
+		} {
+			if got := w.Header().Get(header); got != want {
+				t.Errorf("Accept %s returned %s %q, want %q", accept, header, got, want)
+			}
+		}
+	}
+}
+
+func TestGetFileRange(t *testing.T) {
+	b := newTestBroker(t)
+	NewFileController(b.v1, b.fs, fakeAuth{})
+	expectStatus(t, b.do(http.MethodPost, "/ana/log", []byte("0123456789"), "Content-Type", "text/plain"), http.StatusOK)
+	etag := b.do(http.MethodGet, "/ana/log", nil).Header().Get("ETag")
+
+	w := b.do(http.MethodGet, "/ana/log", nil, "Range", "bytes=-3")
+	expectStatus(t, w, http.StatusPartialContent)
+	if w.Body.String() != "789" || w.Header().Get("Content-Range") != "bytes 7-9/10" {
+		t.Fatalf("tail range returned %q with Content-Range %q", w.Body.String(), w.Header().Get("Content-Range"))
+	}
+
+	w = b.do(http.MethodGet, "/ana/log", nil, "Range", "bytes=0-1,5-6")
+	expectStatus(t, w, http.StatusPartialContent)
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("multiple ranges returned %q, want multipart/byteranges", w.Header().Get("Content-Type"))
+	}
+	var parts []string
+	reader := multipart.NewReader(w.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(part)
+		parts = append(parts, part.Header.Get("Content-Range")+" "+string(content))
+	}
+	if len(parts) != 2 || parts[0] != "bytes 0-1/10 01" || parts[1] != "bytes 5-6/10 56" {
+		t.Fatalf("multiple ranges returned parts %q", parts)
+	}
+
+	w = b.do(http.MethodGet, "/ana/log", nil, "Range", "bytes=10-")
+	expectStatus(t, w, http.StatusRequestedRangeNotSatisfiable)
+	if w.Header().Get("Content-Range") != "bytes */10" {
+		t.Fatalf("unsatisfiable range returned Content-Range %q", w.Header().Get("Content-Range"))
+	}
+
+	// If-Range only applies the range while the document is unchanged
+	expectStatus(t, b.do(http.MethodGet, "/ana/log", nil, "Range", "bytes=0-1", "If-Range", etag), http.StatusPartialContent)
+	expectStatus(t, b.do(http.MethodPut, "/ana/log", []byte("changed"), "Content-Type", "text/plain"), http.StatusOK)
+	w = b.do(http.MethodGet, "/ana/log", nil, "Range", "bytes=0-1", "If-Range", etag)
+	expectStatus(t, w, http.StatusOK)
+	if w.Body.String() != "changed" {
+		t.Fatalf("stale If-Range returned %q, want the whole document", w.Body.String())
+	}
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HeaderConfirmDelete must repeat the folder to delete, as it deletes every document under it at once.
+// The documents go to the trash like any other deletion, each can be restored from there.
+const HeaderConfirmDelete = "X-Confirm-Delete"
+
+type FolderControllerImpl struct {
+	fs service.FolderService
+	as service.AuthService
+}
+
+func NewFolderController(r *gin.RouterGroup, fs service.FolderService, as service.AuthService) *FolderControllerImpl {
+	c := &FolderControllerImpl{fs: fs, as: as}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type FolderController interface {
+	List(c *gin.Context)
+	DeleteFolder(c *gin.Context)
+}
+
+// RegisterRoutes registers the folder routes
+func (fc *FolderControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/:username/_list", fc.List)
+	router.DELETE("/:username/_folders/*folder", fc.DeleteFolder)
+}
+
+// List returns the doc IDs under the prefix query parameter. With delimiter=/ only the
+// immediate children of the prefix are listed, the deeper ones are rolled up into folders.
+func (fc *FolderControllerImpl) List(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, fc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	listing, err := fc.fs.List(username, c.Query("prefix"), c.Query("delimiter"))
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, listing)
+}
+
+// DeleteFolder deletes every document under a folder, at any depth. The request must confirm it
+// by sending the normalised folder path in the X-Confirm-Delete header.
+func (fc *FolderControllerImpl) DeleteFolder(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, fc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	folder, apiErr := service.NormalizeDocID(c.Param("folder"))
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+	if confirm, _ := service.NormalizeDocID(c.GetHeader(HeaderConfirmDelete)); confirm != folder {
+		common.ForwardError(c, common.PreconditionRequiredError("deleting a folder and every document in it must be confirmed with "+HeaderConfirmDelete+": "+folder))
+		return
+	}
+
+	deletion, err := fc.fs.DeleteFolder(username, folder)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	for _, docID := range deletion.Deleted {
+		auditDocument(c, "document.delete", docID, http.StatusOK)
+	}
+	for _, failed := range deletion.Failed {
+		auditDocument(c, "document.delete", failed.DocID, failed.Error.StatusCode)
+	}
+	c.JSON(http.StatusOK, deletion)
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FormUploadControllerImpl struct {
+	fs           service.FileService
+	as           service.AuthService
+	maxPartSize  int64
+	maxTotalSize int64
+}
+
+func NewFormUploadController(r *gin.RouterGroup, fs service.FileService, as service.AuthService) *FormUploadControllerImpl {
+	c := &FormUploadControllerImpl{
+		fs:           fs,
+		as:           as,
+		maxPartSize:  common.GetEnvInt64("FORM_UPLOAD_MAX_PART_SIZE", 32<<20),
+		maxTotalSize: common.GetEnvInt64("FORM_UPLOAD_MAX_TOTAL_SIZE", 256<<20),
+	}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type FormUploadController interface {
+	CreateFiles(c *gin.Context)
+}
+
+// RegisterRoutes registers the multipart form upload routes
+func (fc *FormUploadControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/:username/_files", fc.CreateFiles)
+}
+
+// CreateFiles creates one document per file part of a multipart/form-data request, using the
+// part's filename, folders included, as doc ID. Parts are streamed one at a time and each gets its own result.
+func (fc *FormUploadControllerImpl) CreateFiles(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, fc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, fc.maxTotalSize)
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		common.ForwardError(c, common.UnsupportedMediaTypeError("request must be multipart/form-data"))
+		return
+	}
+
+	results := make([]dao.FileResult, 0)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			results = append(results, dao.FileResult{Error: formBodyError(err)})
+			break
+		}
+		filename := partFileName(part)
+		if filename == "" {
+			// Plain form fields are not documents
+			continue
+		}
+		docID, apiErr := service.NormalizeDocID(filename)
+		if apiErr != nil {
+			results = append(results, dao.FileResult{DocID: filename, Error: apiErr})
+			continue
+		}
+
+		result, stop := fc.createPart(username, docID, part)
+		results = append(results, result)
+		if stop {
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// partFileName returns the filename of a part as sent. Part.FileName only keeps its last element,
+// which would flatten the folders of a drag-and-drop upload into a single one.
+func partFileName(part *multipart.Part) string {
+	_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return params["filename"]
+}
+
+// createPart stores a single part. It reports whether the request body can no longer be read.
+func (fc *FormUploadControllerImpl) createPart(username, docID string, part *multipart.Part) (dao.FileResult, bool) {
+	result := dao.FileResult{DocID: docID}
+	content, err := io.ReadAll(io.LimitReader(part, fc.maxPartSize+1))
+	if err != nil {
+		result.Error = formBodyError(err)
+		return result, true
+	}
+	if int64(len(content)) > fc.maxPartSize {
+		result.Error = common.PayloadTooLargeError("file exceeds the maximum part size")
+		return result, false
+	}
+
+	doc := &dao.Document{Content: content, Metadata: dao.FileMetadata{ContentType: part.Header.Get("Content-Type")}}
+	size, err := fc.fs.CreateFile(username, docID, doc)
+	if err != nil {
+		result.Error = common.PublicError(err)
+		return result, false
+	}
+	result.Size = &size.Size
+	return result, false
+}
+
+// formBodyError maps an error reading the request body to an APIError
+func formBodyError(err error) *common.APIError {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return common.PayloadTooLargeError("request exceeds the maximum total upload size")
+	}
+	return common.BadRequestError("invalid multipart body")
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"seg-red-broker/internal/app/dao"
+	"testing"
+)
+
+func TestCreateFilesFromForm(t *testing.T) {
+	b := newTestBroker(t)
+	t.Setenv("FORM_UPLOAD_MAX_PART_SIZE", "5")
+	NewFormUploadController(b.v1, b.fs, fakeAuth{})
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("comment", "not a document"); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []struct{ name, content string }{
+		{"notes/a.txt", "aaa"},
+		{"big.txt", "too large"},
+		{"../escape", "x"},
+		{"b.txt", "bb"},
+	} {
+		part, err := form.CreateFormFile("files", file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write([]byte(file.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := b.do(http.MethodPost, "/ana/_files", body.Bytes(), "Content-Type", form.FormDataContentType())
+	expectStatus(t, w, http.StatusOK)
+	var results []dao.FileResult
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		docID  string
+		size   int
+		status int
+	}{
+		{"notes/a.txt", 3, 0},
+		{"big.txt", 0, http.StatusRequestEntityTooLarge},
+		{"../escape", 0, http.StatusBadRequest},
+		{"b.txt", 2, 0},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("results %+v, want one per file", results)
+	}
+	for i, w := range want {
+		got := results[i]
+		switch {
+		case got.DocID != w.docID:
+			t.Errorf("result %d is for %s, want %s", i, got.DocID, w.docID)
+		case w.status == 0 && (got.Error != nil || got.Size == nil || *got.Size != w.size):
+			t.Errorf("result for %s %+v, want size %d", w.docID, got, w.size)
+		case w.status != 0 && (got.Error == nil || got.Error.StatusCode != w.status):
+			t.Errorf("result for %s %+v, want status %d", w.docID, got, w.status)
+		}
+	}
+	if content, ok := b.backend.Stored("ana", "b.txt"); !ok || content != "bb" {
+		t.Fatalf("b.txt stored as %q, want its part", content)
+	}
+	if _, ok := b.backend.Stored("ana", "big.txt"); ok {
+		t.Fatal("the part over the size limit was stored")
+	}
+
+	// The total size limit ends the upload
+	t.Setenv("FORM_UPLOAD_MAX_TOTAL_SIZE", "16")
+	b = newTestBroker(t)
+	NewFormUploadController(b.v1, b.fs, fakeAuth{})
+	w = b.do(http.MethodPost, "/ana/_files", body.Bytes(), "Content-Type", form.FormDataContentType())
+	expectStatus(t, w, http.StatusOK)
+	if err := json.Unmarshal(w.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	last := results[len(results)-1]
+	if last.Error == nil || last.Error.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("results %+v, want the upload cut short with 413", results)
+	}
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type ImportControllerImpl struct {
+	is             service.ImportService
+	as             service.AuthService
+	maxArchiveSize int64
+}
+
+func NewImportController(r *gin.RouterGroup, is service.ImportService, as service.AuthService) *ImportControllerImpl {
+	c := &ImportControllerImpl{
+		is:             is,
+		as:             as,
+		maxArchiveSize: common.GetEnvInt64("IMPORT_MAX_ARCHIVE_SIZE", 256<<20),
+	}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type ImportController interface {
+	Import(c *gin.Context)
+}
+
+// RegisterRoutes registers the import routes
+func (ic *ImportControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/:username/_import", ic.Import)
+}
+
+// Import creates documents out of a zip or tar.gz archive sent as request body.
+// The conflict query parameter selects skip (default), overwrite or rename, and dryRun
+// only reports what would be done.
+func (ic *ImportControllerImpl) Import(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, ic.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		common.ForwardError(c, common.BadRequestError("dryRun must be a boolean"))
+		return
+	}
+
+	// Zip archives need random access, so the body is staged in a temporary file
+	archive, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	defer func() {
+		_ = archive.Close()
+		if err := os.Remove(archive.Name()); err != nil {
+			log.Warn("Error removing staged import: ", err)
+		}
+	}()
+	size, err := io.Copy(archive, http.MaxBytesReader(c.Writer, c.Request.Body, ic.maxArchiveSize))
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			common.ForwardError(c, common.PayloadTooLargeError("archive exceeds the maximum size"))
+			return
+		}
+		common.ForwardError(c, common.BadRequestError("invalid request body"))
+		return
+	}
+
+	report, err := ic.is.Import(username, archive, size, c.DefaultQuery("conflict", service.ConflictSkip), dryRun)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	if !dryRun {
+		for _, entry := range report.Imported {
+			auditDocument(c, importAuditAction(entry), entry.DocID, importStatus(entry))
+		}
+		// Entries rejected before they were given a doc ID did not touch any document
+		for _, entry := range report.Failed {
+			if entry.DocID != "" {
+				auditDocument(c, importAuditAction(entry), entry.DocID, entry.Error.StatusCode)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// importAuditAction names an imported document in the audit log like a request on that document
+func importAuditAction(entry dao.ImportEntry) string {
+	if entry.Action == service.ImportOverwritten {
+		return "document.update"
+	}
+	return "document.create"
+}
+
+// importStatus is the status a request writing an imported document would have had
+func importStatus(entry dao.ImportEntry) int {
+	if entry.Action == service.ImportOverwritten {
+		return http.StatusOK
+	}
+	return http.StatusCreated
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers setting the tags and labels of a document on upload, as comma separated lists
+// such as "draft, q3" and "env=prod, team=infra"
+const (
+	HeaderTags   = "X-Tags"
+	HeaderLabels = "X-Labels"
+)
+
+type LabelControllerImpl struct {
+	fs service.FileService
+	as service.AuthService
+}
+
+func NewLabelController(actions DocumentActions, fs service.FileService, as service.AuthService) *LabelControllerImpl {
+	c := &LabelControllerImpl{fs: fs, as: as}
+	c.RegisterRoutes(actions)
+	return c
+}
+
+type LabelController interface {
+	GetLabels(c *gin.Context)
+	SetLabels(c *gin.Context)
+	DeleteLabels(c *gin.Context)
+}
+
+// RegisterRoutes registers the labels subresource, /:username/<doc path>/_labels
+func (lc *LabelControllerImpl) RegisterRoutes(actions DocumentActions) {
+	actions.AddAction(http.MethodGet, "_labels", lc.GetLabels)
+	actions.AddAction(http.MethodPut, "_labels", lc.SetLabels)
+	actions.AddAction(http.MethodDelete, "_labels", lc.DeleteLabels)
+}
+
+// GetLabels returns the tags and labels of a document
+func (lc *LabelControllerImpl) GetLabels(c *gin.Context) {
+	username, docID, err := lc.checkInput(c)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	labels, err := lc.fs.GetLabels(username, docID)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, labels)
+}
+
+// SetLabels replaces the tags and labels of a document with those in the body
+func (lc *LabelControllerImpl) SetLabels(c *gin.Context) {
+	username, docID, err := lc.checkInput(c)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	var labels dao.DocumentLabels
+	if err := c.ShouldBindJSON(&labels); err != nil {
+		common.ForwardError(c, common.BadRequestError("invalid request body"))
+		return
+	}
+	if err := lc.fs.SetLabels(username, docID, &labels); err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	lc.GetLabels(c)
+}
+
+// DeleteLabels removes every tag and label of a document
+func (lc *LabelControllerImpl) DeleteLabels(c *gin.Context) {
+	username, docID, err := lc.checkInput(c)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	if err := lc.fs.SetLabels(username, docID, &dao.DocumentLabels{}); err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (lc *LabelControllerImpl) checkInput(c *gin.Context) (string, string, error) {
+	username, err := CheckOwnerInput(c, lc.as)
+	if err != nil {
+		return "", "", err
+	}
+	_, docID, apiErr := checkParams(c)
+	if apiErr != nil {
+		return "", "", apiErr
+	}
+	return username, docID, nil
+}
+
+// documentLabels sets the tags and labels sent in the headers of an upload. Headers that are
+// not sent leave nil values, for updates to keep the stored ones, while empty ones clear them.
+func documentLabels(c *gin.Context, meta *dao.FileMetadata) *common.APIError {
+	if values, ok := c.Request.Header[HeaderTags]; ok {
+		tags, err := service.ParseTags(strings.Join(values, ","))
+		if err != nil {
+			return common.ToAPIError(err)
+		}
+		meta.Tags = tags
+	}
+	if values, ok := c.Request.Header[HeaderLabels]; ok {
+		labels, err := service.ParseLabels(strings.Join(values, ","))
+		if err != nil {
+			return common.ToAPIError(err)
+		}
+		meta.Labels = labels
+	}
+	return nil
+}
+
+// writeLabelHeaders tells the tags and labels of a document
+func writeLabelHeaders(c *gin.Context, meta *dao.FileMetadata) {
+	if len(meta.Tags) > 0 {
+		c.Header(HeaderTags, strings.Join(meta.Tags, ", "))
+	}
+	if len(meta.Labels) > 0 {
+		c.Header(HeaderLabels, service.FormatLabels(meta.Labels))
+	}
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestLabelSelectors(t *testing.T) {
+	b := newTestBroker(t)
+	files := NewFileController(b.v1, b.fs, fakeAuth{})
+	NewLabelController(files, b.fs, fakeAuth{})
+	expectStatus(t, b.do(http.MethodPost, "/ana/a", []byte("a"), HeaderLabels, "env=prod, team=web", HeaderTags, "draft"), http.StatusOK)
+	expectStatus(t, b.do(http.MethodPost, "/ana/b", []byte("b"), HeaderLabels, "env=prod, team=infra"), http.StatusOK)
+	expectStatus(t, b.do(http.MethodPost, "/ana/c", []byte("c"), HeaderLabels, "env=dev"), http.StatusOK)
+	expectStatus(t, b.do(http.MethodPost, "/ana/notes/d", []byte("d")), http.StatusOK)
+	expectStatus(t, b.do(http.MethodPost, "/ana/e", []byte("e"), HeaderLabels, "bad key=x"), http.StatusBadRequest)
+
+	w := b.do(http.MethodPut, "/ana/notes/d/_labels", []byte(`{"tags":["q3"],"labels":{"env":"prod"}}`))
+	expectStatus(t, w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), `"env":"prod"`) {
+		t.Fatalf("labels set to %s", w.Body.String())
+	}
+	// Updates without the headers keep the labels
+	expectStatus(t, b.do(http.MethodPut, "/ana/a", []byte("a2")), http.StatusOK)
+	w = b.do(http.MethodGet, "/ana/a", nil)
+	if w.Header().Get(HeaderLabels) != "env=prod, team=web" || w.Header().Get(HeaderTags) != "draft" {
+		t.Fatalf("a has labels %q and tags %q after an update", w.Header().Get(HeaderLabels), w.Header().Get(HeaderTags))
+	}
+
+	for query, want := range map[string]string{
+		"selector=env%3Dprod,team!%3Dinfra": "a notes/d",
+		"selector=team":                     "a b",
+		"selector=!team":                    "c notes/d",
+		"selector=env%3D%3Ddev":             "c",
+		"tags=draft":                        "a",
+		"selector=env%3Dprod&tags=q3":       "notes/d",
+		"":                                  "a b c notes/d",
+	} {
+		w := b.do(http.MethodGet, "/ana/_all_docs?"+query, nil)
+		expectStatus(t, w, http.StatusOK)
+		var docs map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &docs); err != nil {
+			t.Fatal(err)
+		}
+		var docIDs []string
+		for docID := range docs {
+			docIDs = append(docIDs, docID)
+		}
+		sort.Strings(docIDs)
+		if got := strings.Join(docIDs, " "); got != want {
+			t.Errorf("%s selected %q, want %q", query, got, want)
+		}
+	}
+	expectStatus(t, b.do(http.MethodGet, "/ana/_all_docs?selector=env%3D%3D%3D", nil), http.StatusBadRequest)
+
+	expectStatus(t, b.do(http.MethodDelete, "/ana/a/_labels", nil), http.StatusOK)
+	w = b.do(http.MethodGet, "/ana/a/_labels", nil)
+	expectStatus(t, w, http.StatusOK)
+	if strings.Contains(w.Body.String(), "prod") || strings.Contains(w.Body.String(), "draft") {
+		t.Fatalf("labels %s after deleting them", w.Body.String())
+	}
+	// Labels are kept by the broker, apart from the content
+	if stored, _ := b.backend.Stored("ana", "b"); stored != "b" {
+		t.Fatalf("b stored as %q", stored)
+	}
+}
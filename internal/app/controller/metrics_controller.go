@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/metrics"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type MetricsControllerImpl struct{}
+
+func NewMetricsController(r *gin.RouterGroup) *MetricsControllerImpl {
+	c := &MetricsControllerImpl{}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type MetricsController interface {
+	GetMetrics(c *gin.Context)
+}
+
+// RegisterRoutes registers the metrics routes
+func (mc *MetricsControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/metrics", mc.GetMetrics)
+}
+
+// GetMetrics writes the broker metrics in the Prometheus text format
+func (mc *MetricsControllerImpl) GetMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := metrics.WriteText(c.Writer); err != nil {
+		log.Error("Error writing metrics: ", err)
+	}
+}
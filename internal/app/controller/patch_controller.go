@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"mime"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PatchControllerImpl struct {
+	ps service.PatchService
+	as service.AuthService
+}
+
+func NewPatchController(r *gin.RouterGroup, ps service.PatchService, as service.AuthService) *PatchControllerImpl {
+	c := &PatchControllerImpl{ps: ps, as: as}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type PatchController interface {
+	PatchFile(c *gin.Context)
+}
+
+// RegisterRoutes registers PATCH on documents, nested doc IDs included
+func (pc *PatchControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.PATCH("/:username/:doc_id", pc.PatchFile)
+	router.PATCH("/:username/:doc_id/*path", pc.PatchFile)
+}
+
+// PatchFile applies the JSON Merge Patch or JSON Patch in the body to a JSON document.
+// If-Match makes the patch conditional on the ETag returned by GetFile.
+func (pc *PatchControllerImpl) PatchFile(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, pc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	_, docID, apiErr := checkParams(c)
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+
+	patchType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if patchType != service.PatchTypeMerge && patchType != service.PatchTypeJSON {
+		c.Header("Accept-Patch", service.PatchTypeMerge+", "+service.PatchTypeJSON)
+	}
+	patch, apiErr := readBody(c)
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+	key, apiErr := customerKey(c)
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+
+	size, etag, err := pc.ps.Patch(username, docID, patchType, patch, c.GetHeader("If-Match"), key)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.Header("ETag", etag)
+	c.JSON(http.StatusOK, size)
+}
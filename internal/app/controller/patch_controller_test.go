@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/service"
+	"testing"
+)
+
+func TestPatchIfMatch(t *testing.T) {
+	b := newTestBroker(t)
+	NewFileController(b.v1, b.fs, fakeAuth{})
+	NewPatchController(b.v1, service.NewPatchService(b.fs), fakeAuth{})
+
+	expectStatus(t, b.do(http.MethodPost, "/ana/doc", []byte(`{"n":1}`)), http.StatusOK)
+	stale := b.do(http.MethodGet, "/ana/doc", nil).Header().Get("ETag")
+
+	w := b.do(http.MethodPatch, "/ana/doc", []byte(`{"n":2}`), "Content-Type", service.PatchTypeMerge, "If-Match", stale)
+	expectStatus(t, w, http.StatusOK)
+	current := w.Header().Get("ETag")
+	if current == "" || current == stale {
+		t.Fatalf("ETag after the patch %q, want a new one", current)
+	}
+
+	w = b.do(http.MethodPatch, "/ana/doc", []byte(`[{"op":"replace","path":"/n","value":3}]`), "Content-Type", service.PatchTypeJSON, "If-Match", stale)
+	expectStatus(t, w, http.StatusPreconditionFailed)
+	if body := b.do(http.MethodGet, "/ana/doc", nil).Body.String(); body != `{"content":"{\"n\":2}"}` {
+		t.Fatalf("document %s after a failed precondition, want n=2", body)
+	}
+
+	w = b.do(http.MethodPatch, "/ana/doc", []byte(`[{"op":"replace","path":"/n","value":3}]`), "Content-Type", service.PatchTypeJSON, "If-Match", current)
+	expectStatus(t, w, http.StatusOK)
+	if got := b.do(http.MethodGet, "/ana/doc", nil).Header().Get("ETag"); got != w.Header().Get("ETag") {
+		t.Fatalf("ETag %q, want the one the patch returned %q", got, w.Header().Get("ETag"))
+	}
+}
+
+func TestPatchRejectsUnknownMediaType(t *testing.T) {
+	b := newTestBroker(t)
+	NewFileController(b.v1, b.fs, fakeAuth{})
+	NewPatchController(b.v1, service.NewPatchService(b.fs), fakeAuth{})
+
+	expectStatus(t, b.do(http.MethodPost, "/ana/doc", []byte(`{"n":1}`)), http.StatusOK)
+	w := b.do(http.MethodPatch, "/ana/doc", []byte(`{"n":2}`), "Content-Type", "application/json")
+	expectStatus(t, w, http.StatusUnsupportedMediaType)
+	if w.Header().Get("Accept-Patch") == "" {
+		t.Fatal("no Accept-Patch header telling the supported patch types")
+	}
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SchemaControllerImpl struct {
+	ss service.SchemaService
+	as service.AuthService
+}
+
+func NewSchemaController(r *gin.RouterGroup, ss service.SchemaService, as service.AuthService) *SchemaControllerImpl {
+	c := &SchemaControllerImpl{ss: ss, as: as}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type SchemaController interface {
+	ListSchemas(c *gin.Context)
+	PutSchema(c *gin.Context)
+	DeleteSchema(c *gin.Context)
+}
+
+// schemaInput is the body of a PutSchema request
+type schemaInput struct {
+	Pattern string          `json:"pattern"`
+	Schema  json.RawMessage `json:"schema"`
+}
+
+// RegisterRoutes registers the schema routes
+func (sc *SchemaControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/:username/_schemas", sc.ListSchemas)
+	router.PUT("/:username/_schemas/:schema_id", sc.PutSchema)
+	router.DELETE("/:username/_schemas/:schema_id", sc.DeleteSchema)
+}
+
+// ListSchemas returns the schemas attached by the user
+func (sc *SchemaControllerImpl) ListSchemas(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, sc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sc.ss.ListSchemas(username))
+}
+
+// PutSchema attaches a JSON Schema to a doc ID pattern
+func (sc *SchemaControllerImpl) PutSchema(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, sc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	var input schemaInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		common.ForwardError(c, common.BadRequestError("invalid request body"))
+		return
+	}
+	if len(input.Schema) == 0 {
+		common.ForwardError(c, common.EmptyParamsError("schema"))
+		return
+	}
+
+	schema, err := sc.ss.PutSchema(username, c.Param("schema_id"), input.Pattern, input.Schema)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, schema)
+}
+
+// DeleteSchema detaches a schema
+func (sc *SchemaControllerImpl) DeleteSchema(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, sc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	if err := sc.ss.DeleteSchema(username, c.Param("schema_id")); err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"seg-red-broker/internal/app/store"
+	"sort"
+	"testing"
+)
+
+func TestSchemaViolations(t *testing.T) {
+	b := newTestBroker(t)
+	schemas := service.NewSchemaService(store.NewSchemaStore())
+	b.fs.AddValidator(schemas)
+	NewFileController(b.v1, b.fs, fakeAuth{})
+	NewSchemaController(b.v1, schemas, fakeAuth{})
+
+	schema := []byte(`{"pattern":"config/*.json","schema":{
+		"type":"object",
+		"required":["name"],
+		"properties":{"port":{"type":"integer","maximum":65535},"hosts":{"type":"array","items":{"type":"string"}}}
+	}}`)
+	expectStatus(t, b.do(http.MethodPut, "/ana/_schemas/config", schema), http.StatusOK)
+	expectStatus(t, b.do(http.MethodPut, "/ana/_schemas/broken", []byte(`{"pattern":"*","schema":{"type":12}}`)), http.StatusBadRequest)
+
+	w := b.do(http.MethodPost, "/ana/config/app.json", []byte(`{"port":70000,"hosts":["a",2]}`))
+	expectStatus(t, w, http.StatusUnprocessableEntity)
+	var apiErr struct {
+		Details []dao.SchemaViolation `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &apiErr); err != nil {
+		t.Fatal(err)
+	}
+	var pointers []string
+	for _, violation := range apiErr.Details {
+		if violation.SchemaID != "config" || violation.Message == "" {
+			t.Errorf("violation %+v, want the schema ID and a message", violation)
+		}
+		pointers = append(pointers, violation.Pointer)
+	}
+	sort.Strings(pointers)
+	if len(pointers) != 3 || pointers[0] != "" || pointers[1] != "/hosts/1" || pointers[2] != "/port" {
+		t.Fatalf("violations at %q, want the missing name, /hosts/1 and /port", pointers)
+	}
+
+	expectStatus(t, b.do(http.MethodPost, "/ana/config/app.json", []byte(`{"name":`)), http.StatusUnprocessableEntity)
+	expectStatus(t, b.do(http.MethodPost, "/ana/config/app.json", []byte(`{"name":"app","port":8080}`)), http.StatusOK)
+	// Updates are validated too, and documents outside the pattern are not
+	expectStatus(t, b.do(http.MethodPut, "/ana/config/app.json", []byte(`{"port":8080}`)), http.StatusUnprocessableEntity)
+	expectStatus(t, b.do(http.MethodPost, "/ana/notes.json", []byte(`{"port":"any"}`)), http.StatusOK)
+
+	expectStatus(t, b.do(http.MethodDelete, "/ana/_schemas/config", nil), http.StatusOK)
+	expectStatus(t, b.do(http.MethodPut, "/ana/config/app.json", []byte(`{"port":8080}`)), http.StatusOK)
+}
@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScrubControllerImpl struct {
+	ss service.ScrubService
+	as service.AuthService
+}
+
+func NewScrubController(r *gin.RouterGroup, ss service.ScrubService, as service.AuthService) *ScrubControllerImpl {
+	c := &ScrubControllerImpl{ss: ss, as: as}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type ScrubController interface {
+	Scrub(c *gin.Context)
+}
+
+// RegisterRoutes registers the scrub routes
+func (sc *ScrubControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/:username/_scrub", sc.Scrub)
+}
+
+// Scrub checks every document of the user against its checksum and reports the drift
+func (sc *ScrubControllerImpl) Scrub(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, sc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	report, err := sc.ss.Scrub(username)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
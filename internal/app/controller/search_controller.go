@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSearchLimit = 10
+	maxSearchLimit     = 100
+)
+
+type SearchControllerImpl struct {
+	ss service.SearchService
+	as service.AuthService
+}
+
+func NewSearchController(r *gin.RouterGroup, ss service.SearchService, as service.AuthService) *SearchControllerImpl {
+	c := &SearchControllerImpl{ss: ss, as: as}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type SearchController interface {
+	Search(c *gin.Context)
+	Rebuild(c *gin.Context)
+}
+
+// RegisterRoutes registers the search routes
+func (sc *SearchControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/:username/_search", sc.Search)
+	router.POST("/:username/_search/_rebuild", sc.Rebuild)
+}
+
+// Search returns the documents of the user matching the q query parameter. Documents encrypted at
+// rest or with a customer key are never indexed, as the index is kept in plain text, so once
+// encryption is enabled only the documents written before it can be found.
+func (sc *SearchControllerImpl) Search(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, sc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSearchLimit)))
+	if err != nil || limit < 1 || limit > maxSearchLimit {
+		common.ForwardError(c, common.BadRequestError("limit must be between 1 and "+strconv.Itoa(maxSearchLimit)))
+		return
+	}
+
+	results, err := sc.ss.Search(username, c.Query("q"), limit)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, results)
+}
+
+// Rebuild indexes again every document of the user from the file service
+func (sc *SearchControllerImpl) Rebuild(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, sc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	if err := sc.ss.Rebuild(username); err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TransferControllerImpl struct {
+	ts service.TransferService
+	as service.AuthService
+}
+
+func NewTransferController(actions DocumentActions, ts service.TransferService, as service.AuthService) *TransferControllerImpl {
+	c := &TransferControllerImpl{ts: ts, as: as}
+	c.RegisterRoutes(actions)
+	return c
+}
+
+type TransferController interface {
+	Move(c *gin.Context)
+	Copy(c *gin.Context)
+}
+
+// RegisterRoutes registers the move and copy actions, POST /:username/<doc path>/_move and _copy
+func (tc *TransferControllerImpl) RegisterRoutes(actions DocumentActions) {
+	actions.AddAction(http.MethodPost, "_move", tc.Move)
+	actions.AddAction(http.MethodPost, "_copy", tc.Copy)
+}
+
+// Move renames a document, overwriting or renaming around an existing destination as requested
+func (tc *TransferControllerImpl) Move(c *gin.Context) {
+	tc.transfer(c, tc.ts.Move)
+}
+
+// Copy duplicates a document under another doc ID
+func (tc *TransferControllerImpl) Copy(c *gin.Context) {
+	tc.transfer(c, tc.ts.Copy)
+}
+
+func (tc *TransferControllerImpl) transfer(c *gin.Context, op func(string, string, dao.TransferRequest, []byte) (*dao.TransferResult, error)) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, tc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	_, docID, apiErr := checkParams(c)
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+
+	var req dao.TransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ForwardError(c, common.BadRequestError("invalid request body"))
+		return
+	}
+	// A customer key decrypts the source and encrypts the destination
+	key, apiErr := customerKey(c)
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+
+	result, err := op(username, docID, req, key)
+	if err != nil {
+		// A move failing after the destination was written also touched the destination
+		var apiErr *common.APIError
+		if errors.As(err, &apiErr) {
+			if failure, ok := apiErr.Details.(*dao.TransferFailure); ok {
+				auditDocument(c, "document."+failure.Operation, failure.Destination, apiErr.StatusCode)
+			}
+		}
+		common.HandleError(c, err)
+		return
+	}
+	// The source is the target of the request, the destination is recorded on its own
+	if result.Overwritten {
+		auditDocument(c, "document.update", result.Destination, http.StatusOK)
+	} else {
+		auditDocument(c, "document.create", result.Destination, http.StatusCreated)
+	}
+	c.JSON(http.StatusOK, result)
+}
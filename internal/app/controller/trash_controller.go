@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TrashControllerImpl struct {
+	ts service.TrashService
+	as service.AuthService
+}
+
+func NewTrashController(r *gin.RouterGroup, ts service.TrashService, as service.AuthService) *TrashControllerImpl {
+	c := &TrashControllerImpl{ts: ts, as: as}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type TrashController interface {
+	List(c *gin.Context)
+	Restore(c *gin.Context)
+	Purge(c *gin.Context)
+	Empty(c *gin.Context)
+}
+
+// RegisterRoutes registers the trash routes
+func (tc *TrashControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/:username/_trash", tc.List)
+	router.POST("/:username/_trash/:trash_id/_restore", tc.Restore)
+	router.DELETE("/:username/_trash/:trash_id", tc.Purge)
+	router.DELETE("/:username/_trash", tc.Empty)
+}
+
+// List returns the deleted documents of the user that can still be restored
+func (tc *TrashControllerImpl) List(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, tc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tc.ts.List(username))
+}
+
+// Restore puts a deleted document back under its doc ID, the conflict query parameter
+// telling whether to fail or overwrite if a document has been written there since
+func (tc *TrashControllerImpl) Restore(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, tc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	item, err := tc.ts.Restore(username, c.Param("trash_id"), c.Query("conflict"))
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// Purge deletes a document of the trash for good
+func (tc *TrashControllerImpl) Purge(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, tc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	if err := tc.ts.Purge(username, c.Param("trash_id")); err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// Empty deletes every document of the trash for good
+func (tc *TrashControllerImpl) Empty(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, tc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	purged, err := tc.ts.Empty(username)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
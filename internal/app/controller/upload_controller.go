@@ -0,0 +1,184 @@
+package controller
+
+import (
+	"encoding/base64"
+	"net/http"
+	"regexp"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tusVersion is the version of the tus resumable upload protocol spoken by the upload routes
+const tusVersion = "1.0.0"
+
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+type UploadControllerImpl struct {
+	us service.UploadService
+	as service.AuthService
+}
+
+func NewUploadController(r *gin.RouterGroup, us service.UploadService, as service.AuthService) *UploadControllerImpl {
+	c := &UploadControllerImpl{us: us, as: as}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type UploadController interface {
+	CreateUpload(c *gin.Context)
+	GetUploadOffset(c *gin.Context)
+	WriteChunk(c *gin.Context)
+	DeleteUpload(c *gin.Context)
+}
+
+// RegisterRoutes registers the resumable upload routes, a subset of tus 1.0.0
+// (core protocol plus the creation, termination and expiration extensions)
+func (uc *UploadControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/:username/_uploads", uc.CreateUpload)
+	router.HEAD("/:username/_uploads/:upload_id", uc.GetUploadOffset)
+	router.PATCH("/:username/_uploads/:upload_id", uc.WriteChunk)
+	router.DELETE("/:username/_uploads/:upload_id", uc.DeleteUpload)
+}
+
+// CreateUpload opens an upload session. The target doc ID and content type are taken from the
+// "filename" and "filetype" keys of the Upload-Metadata header, as sent by tus clients.
+func (uc *UploadControllerImpl) CreateUpload(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	username, err := CheckOwnerInput(c, uc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil {
+		common.ForwardError(c, common.BadRequestError("invalid Upload-Length header"))
+		return
+	}
+	metadata, apiErr := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+	if metadata["filename"] == "" {
+		common.ForwardError(c, common.EmptyParamsError("filename"))
+		return
+	}
+	docID, apiErr := service.NormalizeDocID(metadata["filename"])
+	if apiErr != nil {
+		common.ForwardError(c, apiErr)
+		return
+	}
+
+	session, err := uc.us.CreateUpload(username, docID, metadata["filetype"], length)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.Header("Location", strings.TrimSuffix(c.Request.URL.Path, "/")+"/"+session.ID)
+	writeUploadHeaders(c, session)
+	c.Status(http.StatusCreated)
+}
+
+// GetUploadOffset reports how many bytes of an upload have been received
+func (uc *UploadControllerImpl) GetUploadOffset(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	username, uploadID, err := uc.checkUploadParams(c)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	session, err := uc.us.GetUpload(username, uploadID)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	writeUploadHeaders(c, session)
+	c.Status(http.StatusOK)
+}
+
+// WriteChunk appends the request body to an upload at the offset given by Upload-Offset
+func (uc *UploadControllerImpl) WriteChunk(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	username, uploadID, err := uc.checkUploadParams(c)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		common.ForwardError(c, common.UnsupportedMediaTypeError("content type must be application/offset+octet-stream"))
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		common.ForwardError(c, common.BadRequestError("invalid Upload-Offset header"))
+		return
+	}
+
+	session, err := uc.us.WriteChunk(username, uploadID, offset, c.Request.Body)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	writeUploadHeaders(c, session)
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload aborts an upload
+func (uc *UploadControllerImpl) DeleteUpload(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	username, uploadID, err := uc.checkUploadParams(c)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	if err := uc.us.DeleteUpload(username, uploadID); err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// checkUploadParams checks the owner and the upload ID
+func (uc *UploadControllerImpl) checkUploadParams(c *gin.Context) (string, string, error) {
+	username, err := CheckOwnerInput(c, uc.as)
+	if err != nil {
+		return "", "", err
+	}
+	uploadID := c.Param("upload_id")
+	if !uploadIDPattern.MatchString(uploadID) {
+		return "", "", common.NotFoundError("upload not found")
+	}
+	return username, uploadID, nil
+}
+
+func writeUploadHeaders(c *gin.Context, session *dao.UploadSession) {
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.Length, 10))
+	c.Header("Upload-Expires", session.ExpiresAt.Format(http.TimeFormat))
+}
+
+// parseUploadMetadata decodes a tus Upload-Metadata header: comma separated "key base64value" pairs
+func parseUploadMetadata(header string) (map[string]string, *common.APIError) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if key == "" || err != nil {
+			return nil, common.BadRequestError("invalid Upload-Metadata header")
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
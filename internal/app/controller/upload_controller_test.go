@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"seg-red-broker/internal/app/service"
+	"seg-red-broker/internal/app/store"
+	"testing"
+)
+
+func TestUploadResume(t *testing.T) {
+	b := newTestBroker(t)
+	NewUploadController(b.v1, service.NewUploadService(b.fs, store.NewUploadStore()), fakeAuth{})
+
+	// "report.txt" and "text/plain" in base64
+	w := b.do(http.MethodPost, "/ana/_uploads", nil, "Upload-Length", "10", "Upload-Metadata", "filename cmVwb3J0LnR4dA==,filetype dGV4dC9wbGFpbg==")
+	expectStatus(t, w, http.StatusCreated)
+	location := w.Header().Get("Location")[len("/api/v1"):]
+	chunk := func(offset, content string) *httptest.ResponseRecorder {
+		return b.do(http.MethodPatch, location, []byte(content), "Content-Type", "application/offset+octet-stream", "Upload-Offset", offset)
+	}
+	offset := func() string {
+		w := b.do(http.MethodHead, location, nil)
+		expectStatus(t, w, http.StatusOK)
+		return w.Header().Get("Upload-Offset")
+	}
+
+	w = chunk("0", "0123")
+	expectStatus(t, w, http.StatusNoContent)
+	if got := w.Header().Get("Upload-Offset"); got != "4" {
+		t.Fatalf("offset %s after the first chunk, want 4", got)
+	}
+	// A client resuming from a stale offset is told to ask for the current one
+	expectStatus(t, chunk("0", "0123"), http.StatusConflict)
+	// A chunk going past Upload-Length is refused whole
+	expectStatus(t, chunk("4", "4567890"), http.StatusRequestEntityTooLarge)
+	if got := offset(); got != "4" {
+		t.Fatalf("offset %s after a rejected chunk, want 4", got)
+	}
+
+	expectStatus(t, chunk(offset(), "456789"), http.StatusNoContent)
+	if content, ok := b.backend.Stored("ana", "report.txt"); !ok || content != "0123456789" {
+		t.Fatalf("uploaded document %q, want the chunks in order", content)
+	}
+	// The session is gone once the document is created
+	expectStatus(t, b.do(http.MethodHead, location, nil), http.StatusNotFound)
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UsageControllerImpl struct {
+	qs service.QuotaService
+	as service.AuthService
+}
+
+func NewUsageController(r *gin.RouterGroup, qs service.QuotaService, as service.AuthService) *UsageControllerImpl {
+	c := &UsageControllerImpl{qs: qs, as: as}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type UsageController interface {
+	GetUsage(c *gin.Context)
+	Reconcile(c *gin.Context)
+}
+
+// RegisterRoutes registers the usage routes
+func (uc *UsageControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/:username/_usage", uc.GetUsage)
+	router.POST("/:username/_usage/_reconcile", uc.Reconcile)
+}
+
+// GetUsage returns the storage used by the user and the quota that applies
+func (uc *UsageControllerImpl) GetUsage(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, uc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	usage, err := uc.qs.GetUsage(username)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+// Reconcile recomputes the usage of the user from the file service
+func (uc *UsageControllerImpl) Reconcile(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, uc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	if err := uc.qs.Reconcile(username); err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	usage, err := uc.qs.GetUsage(username)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
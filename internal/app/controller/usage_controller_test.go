@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+	"seg-red-broker/internal/app/store"
+	"testing"
+)
+
+func TestQuotas(t *testing.T) {
+	b := newTestBroker(t)
+	t.Setenv("QUOTA_MAX_BYTES", "100")
+	overrides := `{"ana":{"maxBytes":10,"maxDocuments":2,"maxDocumentSize":8}}`
+	if err := os.WriteFile(filepath.Join(os.Getenv("DATA_FOLDER"), "quotas.json"), []byte(overrides), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	qs := service.NewQuotaService(b.fs, store.NewUsageStore(), store.NewQuotaStore())
+	b.fs.AddValidator(qs)
+	b.fs.AddListener(qs)
+	NewFileController(b.v1, b.fs, fakeAuth{})
+	NewUsageController(b.v1, qs, fakeAuth{})
+	usage := func(w *httptest.ResponseRecorder) dao.UsageReport {
+		t.Helper()
+		expectStatus(t, w, http.StatusOK)
+		var report dao.UsageReport
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	expectStatus(t, b.do(http.MethodPost, "/ana/a", []byte("12345")), http.StatusOK)
+	expectStatus(t, b.do(http.MethodPost, "/ana/b", []byte("123456789")), http.StatusRequestEntityTooLarge)
+	expectStatus(t, b.do(http.MethodPost, "/ana/b", []byte("123456")), http.StatusInsufficientStorage)
+	expectStatus(t, b.do(http.MethodPost, "/ana/b", []byte("1234")), http.StatusOK)
+	expectStatus(t, b.do(http.MethodPost, "/ana/c", []byte("1")), http.StatusInsufficientStorage)
+	// Replacing a document only counts the difference
+	expectStatus(t, b.do(http.MethodPut, "/ana/a", []byte("123456")), http.StatusOK)
+
+	report := usage(b.do(http.MethodGet, "/ana/_usage", nil))
+	if report.Bytes != 10 || report.Documents != 2 || report.Quota.MaxBytes != 10 {
+		t.Fatalf("usage %+v, want 10 bytes in 2 documents with the override", report)
+	}
+
+	// Reconciling picks up the documents written behind the broker
+	b.backend.Put("ana", "c", "xyz")
+	report = usage(b.do(http.MethodPost, "/ana/_usage/_reconcile", nil))
+	if report.Bytes != 13 || report.Documents != 3 {
+		t.Fatalf("reconciled usage %+v, want 13 bytes in 3 documents", report)
+	}
+
+	// Users without an override get the default quota
+	report = usage(b.do(http.MethodGet, "/bob/_usage", nil, "Authorization", "bob"))
+	if report.Quota.MaxBytes != 100 || report.Quota.MaxDocuments != 0 {
+		t.Fatalf("quota of bob %+v, want the default one", report.Quota)
+	}
+}
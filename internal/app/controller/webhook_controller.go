@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookControllerImpl struct {
+	ws service.WebhookService
+	as service.AuthService
+}
+
+func NewWebhookController(r *gin.RouterGroup, ws service.WebhookService, as service.AuthService) *WebhookControllerImpl {
+	c := &WebhookControllerImpl{ws: ws, as: as}
+	c.RegisterRoutes(r)
+	return c
+}
+
+type WebhookController interface {
+	Subscribe(c *gin.Context)
+	List(c *gin.Context)
+	Unsubscribe(c *gin.Context)
+	Deliveries(c *gin.Context)
+	Replay(c *gin.Context)
+}
+
+// RegisterRoutes registers the webhook routes
+func (wc *WebhookControllerImpl) RegisterRoutes(router *gin.RouterGroup) {
+	router.POST("/:username/_webhooks", wc.Subscribe)
+	router.GET("/:username/_webhooks", wc.List)
+	router.DELETE("/:username/_webhooks/:webhook_id", wc.Unsubscribe)
+	router.GET("/:username/_webhooks/:webhook_id/_deliveries", wc.Deliveries)
+	router.POST("/:username/_webhooks/:webhook_id/_deliveries/:delivery_id/_replay", wc.Replay)
+}
+
+// Subscribe creates a webhook, returning its secret for the receiver to check the signatures
+func (wc *WebhookControllerImpl) Subscribe(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, wc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+
+	var req dao.WebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ForwardError(c, common.BadRequestError("invalid request body"))
+		return
+	}
+	webhook, err := wc.ws.Subscribe(username, req)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, webhook)
+}
+
+// List returns the webhooks of the user
+func (wc *WebhookControllerImpl) List(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, wc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, wc.ws.List(username))
+}
+
+// Unsubscribe deletes a webhook
+func (wc *WebhookControllerImpl) Unsubscribe(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, wc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	if err := wc.ws.Unsubscribe(username, c.Param("webhook_id")); err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// Deliveries returns the delivery log of a webhook
+func (wc *WebhookControllerImpl) Deliveries(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, wc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	deliveries, err := wc.ws.Deliveries(username, c.Param("webhook_id"))
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, deliveries)
+}
+
+// Replay delivers a logged event again, the new delivery being attempted in the background
+func (wc *WebhookControllerImpl) Replay(c *gin.Context) {
+	// Check the token and the owner
+	username, err := CheckOwnerInput(c, wc.as)
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	delivery, err := wc.ws.Replay(username, c.Param("webhook_id"), c.Param("delivery_id"))
+	if err != nil {
+		common.HandleError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, delivery)
+}
@@ -0,0 +1,45 @@
+package dao
+
+import "time"
+
+// AuditEntry records an authentication or a request on the documents of a user. Entries are
+// chained: Hash covers the entry with the Hash of the one before as PrevHash.
+type AuditEntry struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	ClientIP  string    `json:"clientIp"`
+	// Actor is the authenticated user, or the one signing up or logging in
+	Actor  string `json:"actor,omitempty"`
+	Action string `json:"action"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Target is the user or the document, as username/docID, the request was about
+	Target   string `json:"target,omitempty"`
+	Status   int    `json:"status"`
+	Outcome  string `json:"outcome"`
+	PrevHash string `json:"prevHash"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// AuditQuery filters the audit log. User matches the actor or the owner of the target.
+type AuditQuery struct {
+	User  string
+	DocID string
+	From  *time.Time
+	To    *time.Time
+	Limit int
+}
+
+// AuditVerification is the result of checking the hash chain of an audit log. Head is the hash
+// of the last valid entry, comparing it with a copy kept elsewhere also detects truncation.
+type AuditVerification struct {
+	Valid bool `json:"valid"`
+	// Keyed tells whether the hashes were checked with the key of the log
+	Keyed   bool   `json:"keyed"`
+	Entries int    `json:"entries"`
+	Head    string `json:"head"`
+	// Line is the first line of the log that fails the check, if any
+	Line  int    `json:"line,omitempty"`
+	Error string `json:"error,omitempty"`
+}
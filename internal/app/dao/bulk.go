@@ -0,0 +1,23 @@
+package dao
+
+import "seg-red-broker/internal/app/common"
+
+// BulkOperation is one of the operations of a bulk request
+type BulkOperation struct {
+	Op          string `json:"op"`
+	DocID       string `json:"docId"`
+	Content     string `json:"content,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// BulkResult is the outcome of a BulkOperation
+type BulkResult struct {
+	Op       string           `json:"op"`
+	DocID    string           `json:"docId"`
+	Status   int              `json:"status"`
+	Size     *int             `json:"size,omitempty"`
+	Content  *string          `json:"content,omitempty"`
+	Encoding string           `json:"encoding,omitempty"`
+	Error    *common.APIError `json:"error,omitempty"`
+}
@@ -0,0 +1,12 @@
+package dao
+
+import "time"
+
+// ChangeEvent is a change of a document streamed by the change feed of its owner
+type ChangeEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	DocID      string    `json:"docId,omitempty"`
+	Size       *int      `json:"size,omitempty"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
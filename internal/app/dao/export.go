@@ -0,0 +1,24 @@
+package dao
+
+import (
+	"seg-red-broker/internal/app/common"
+	"time"
+)
+
+// ExportManifest describes the content of an export archive
+type ExportManifest struct {
+	Username   string        `json:"username"`
+	ExportedAt time.Time     `json:"exportedAt"`
+	Documents  []ExportEntry `json:"documents"`
+}
+
+// ExportEntry describes one document of an export archive
+type ExportEntry struct {
+	DocID       string           `json:"docId"`
+	Path        string           `json:"path,omitempty"`
+	ContentType string           `json:"contentType,omitempty"`
+	Size        int              `json:"size"`
+	CreatedAt   time.Time        `json:"createdAt"`
+	UpdatedAt   time.Time        `json:"updatedAt"`
+	Error       *common.APIError `json:"error,omitempty"`
+}
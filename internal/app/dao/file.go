@@ -1,9 +1,65 @@
 package dao
 
+import (
+	"seg-red-broker/internal/app/common"
+	"time"
+)
+
 type FileSize struct {
 	Size int `json:"size"`
+	// DocID is the document written by an append, which differs from the one requested after a rollover
+	DocID string `json:"docId,omitempty"`
 }
 
 type FileContent struct {
 	Content string `json:"content"`
 }
+
+// FileMetadata is the information the broker keeps about a document besides its content
+type FileMetadata struct {
+	ContentType string    `json:"contentType,omitempty"`
+	Encoding    string    `json:"encoding,omitempty"`
+	Compression string    `json:"compression,omitempty"`
+	Size        int       `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	// SHA256 is the hex checksum of the content, keyed by the customer key of documents encrypted
+	// with one. It is empty for documents stored before checksums.
+	SHA256 string `json:"sha256,omitempty"`
+	// Encryption is set when the content is stored encrypted
+	Encryption *EncryptionInfo `json:"encryption,omitempty"`
+	// ExpiresAt is when the document stops being readable and is deleted by the reaper
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Scan is the verdict of the content scanners on documents quarantined or tagged by them
+	Scan *ScanResult `json:"scan,omitempty"`
+	// Tags and Labels organise documents, they are only kept by the broker
+	Tags   []string          `json:"tags,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// EncryptionInfo describes how the content of a document was encrypted. The data key is
+// kept wrapped by the key-encryption key of the user derived from the master key KeyID.
+// Documents encrypted with a key supplied by their owner have neither, only the owner can read them.
+type EncryptionInfo struct {
+	Algorithm   string `json:"algorithm"`
+	KeyID       string `json:"keyId,omitempty"`
+	WrappedKey  []byte `json:"wrappedKey,omitempty"`
+	CustomerKey bool   `json:"customerKey,omitempty"`
+}
+
+// Document is the raw content of a file together with its metadata
+type Document struct {
+	Content  []byte
+	Metadata FileMetadata
+	// CustomerKey encrypts the content instead of a broker key when set. It is never stored.
+	CustomerKey []byte `json:"-"`
+	// IfMatch makes an update conditional on the entity tag of the document it replaces
+	IfMatch string `json:"-"`
+}
+
+// FileResult is the outcome for one document of a request that writes several of them
+type FileResult struct {
+	DocID string           `json:"docId"`
+	Size  *int             `json:"size,omitempty"`
+	Error *common.APIError `json:"error,omitempty"`
+}
@@ -0,0 +1,16 @@
+package dao
+
+// FolderListing lists the documents and folders under a prefix
+type FolderListing struct {
+	Prefix    string   `json:"prefix"`
+	Delimiter string   `json:"delimiter,omitempty"`
+	Documents []string `json:"documents"`
+	Folders   []string `json:"folders"`
+}
+
+// FolderDeletion is the outcome of deleting a folder and every document under it
+type FolderDeletion struct {
+	Folder  string       `json:"folder"`
+	Deleted []string     `json:"deleted"`
+	Failed  []FileResult `json:"failed"`
+}
@@ -0,0 +1,21 @@
+package dao
+
+import "seg-red-broker/internal/app/common"
+
+// ImportReport tells what happened with every entry of an imported archive
+type ImportReport struct {
+	DryRun   bool          `json:"dryRun"`
+	Imported []ImportEntry `json:"imported"`
+	Skipped  []ImportEntry `json:"skipped"`
+	Failed   []ImportEntry `json:"failed"`
+}
+
+// ImportEntry is the outcome of one archive entry
+type ImportEntry struct {
+	Path   string           `json:"path"`
+	DocID  string           `json:"docId,omitempty"`
+	Action string           `json:"action,omitempty"`
+	Size   int              `json:"size"`
+	Reason string           `json:"reason,omitempty"`
+	Error  *common.APIError `json:"error,omitempty"`
+}
@@ -0,0 +1,7 @@
+package dao
+
+// DocumentLabels are the tags and key/value labels of a document
+type DocumentLabels struct {
+	Tags   []string          `json:"tags"`
+	Labels map[string]string `json:"labels"`
+}
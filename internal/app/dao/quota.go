@@ -0,0 +1,31 @@
+package dao
+
+import "time"
+
+// Quota limits the storage of a user. Zero values mean no limit.
+type Quota struct {
+	MaxBytes        int64 `json:"maxBytes"`
+	MaxDocuments    int64 `json:"maxDocuments"`
+	MaxDocumentSize int64 `json:"maxDocumentSize"`
+}
+
+// Usage is the storage used by a user, with the size of each document. The documents in the
+// trash count in Bytes until they are purged, not in Documents.
+type Usage struct {
+	Bytes     int64          `json:"bytes"`
+	Documents int64          `json:"documents"`
+	Sizes     map[string]int `json:"sizes"`
+	// Trashed holds the size of the documents in the trash, by trash entry ID
+	Trashed      map[string]int `json:"trashed,omitempty"`
+	ReconciledAt time.Time      `json:"reconciledAt"`
+}
+
+// UsageReport is the usage of a user together with the quota that applies
+type UsageReport struct {
+	Username     string    `json:"username"`
+	Bytes        int64     `json:"bytes"`
+	TrashBytes   int64     `json:"trashBytes"`
+	Documents    int64     `json:"documents"`
+	Quota        Quota     `json:"quota"`
+	ReconciledAt time.Time `json:"reconciledAt"`
+}
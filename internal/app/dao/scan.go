@@ -0,0 +1,19 @@
+package dao
+
+import "time"
+
+// ScanResult is the verdict of the content scanners on a document and the outcome applied
+type ScanResult struct {
+	Outcome   string        `json:"outcome"`
+	Findings  []ScanFinding `json:"findings"`
+	ScannedAt time.Time     `json:"scannedAt"`
+}
+
+// ScanFinding is something a scanner found in a document. The matched content itself is
+// never reported, it may be the very secret the scan is looking for.
+type ScanFinding struct {
+	Scanner  string `json:"scanner"`
+	Category string `json:"category"`
+	Rule     string `json:"rule"`
+	Count    int    `json:"count"`
+}
@@ -0,0 +1,21 @@
+package dao
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DocumentSchema is a JSON Schema that the documents whose doc ID matches Pattern must satisfy
+type DocumentSchema struct {
+	ID        string          `json:"id"`
+	Pattern   string          `json:"pattern"`
+	Schema    json.RawMessage `json:"schema"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// SchemaViolation is a validation error located by a JSON pointer into the document
+type SchemaViolation struct {
+	SchemaID string `json:"schemaId"`
+	Pointer  string `json:"pointer"`
+	Message  string `json:"message"`
+}
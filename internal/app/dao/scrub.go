@@ -0,0 +1,28 @@
+package dao
+
+import (
+	"seg-red-broker/internal/app/common"
+	"time"
+)
+
+// ScrubReport is the outcome of checking the stored documents of a user against their checksums
+type ScrubReport struct {
+	Username   string    `json:"username"`
+	ScrubbedAt time.Time `json:"scrubbedAt"`
+	Checked    int       `json:"checked"`
+	// Recorded counts the documents stored without a checksum, whose checksum was recorded
+	Recorded int `json:"recorded"`
+	// Skipped counts the documents encrypted with a customer key, which the broker cannot read,
+	// and the quarantined ones
+	Skipped int          `json:"skipped"`
+	Drifted []ScrubEntry `json:"drifted"`
+	Errors  []ScrubEntry `json:"errors"`
+}
+
+// ScrubEntry is a document whose content does not match its checksum or could not be read
+type ScrubEntry struct {
+	DocID    string           `json:"docId"`
+	Expected string           `json:"expected,omitempty"`
+	Actual   string           `json:"actual,omitempty"`
+	Error    *common.APIError `json:"error,omitempty"`
+}
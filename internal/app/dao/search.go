@@ -0,0 +1,27 @@
+package dao
+
+// SearchIndex is the inverted index of the documents of a user
+type SearchIndex struct {
+	// Lengths holds the number of tokens of every indexed document
+	Lengths map[string]int `json:"lengths"`
+	// Postings holds, for every term, the token positions where each document contains it
+	Postings map[string]map[string][]int `json:"postings"`
+	// Terms holds the distinct terms of every indexed document, so that removing one
+	// only touches its own postings
+	Terms map[string][]string `json:"terms,omitempty"`
+}
+
+// SearchIndexChange replaces the entry of a document in a SearchIndex. A change without
+// postings only removes the document.
+type SearchIndexChange struct {
+	DocID    string           `json:"docId"`
+	Length   int              `json:"length,omitempty"`
+	Postings map[string][]int `json:"postings,omitempty"`
+}
+
+// SearchResult is a document matching a search query
+type SearchResult struct {
+	DocID    string   `json:"docId"`
+	Score    float64  `json:"score"`
+	Snippets []string `json:"snippets"`
+}
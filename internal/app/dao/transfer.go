@@ -0,0 +1,31 @@
+package dao
+
+import "seg-red-broker/internal/app/common"
+
+// TransferRequest is the body of a move or copy request
+type TransferRequest struct {
+	Destination string `json:"destination"`
+	// Conflict is what to do when the destination exists: fail, overwrite or rename
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// TransferResult is the outcome of a successful move or copy
+type TransferResult struct {
+	Operation   string `json:"operation"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Overwritten bool   `json:"overwritten"`
+	Size        int    `json:"size"`
+}
+
+// TransferFailure details a move that failed after the destination was written, and whether
+// the destination could be put back as it was
+type TransferFailure struct {
+	Operation     string           `json:"operation"`
+	Source        string           `json:"source"`
+	Destination   string           `json:"destination"`
+	FailedStep    string           `json:"failedStep"`
+	Error         *common.APIError `json:"error"`
+	RolledBack    bool             `json:"rolledBack"`
+	RollbackError *common.APIError `json:"rollbackError,omitempty"`
+}
@@ -0,0 +1,19 @@
+package dao
+
+import "time"
+
+// TrashItem is a deleted document waiting in the trash of its owner to be restored or purged
+type TrashItem struct {
+	ID          string     `json:"id"`
+	DocID       string     `json:"docId"`
+	Size        int        `json:"size"`
+	ContentType string     `json:"contentType,omitempty"`
+	DeletedAt   time.Time  `json:"deletedAt"`
+	PurgeAt     *time.Time `json:"purgeAt,omitempty"`
+}
+
+// TrashEntry is a TrashItem with the metadata needed to read the document back
+type TrashEntry struct {
+	TrashItem
+	Metadata FileMetadata `json:"metadata"`
+}
@@ -0,0 +1,14 @@
+package dao
+
+import "time"
+
+// UploadSession tracks a resumable upload whose chunks are staged by the broker
+type UploadSession struct {
+	ID          string    `json:"id"`
+	Username    string    `json:"username"`
+	DocID       string    `json:"docId"`
+	ContentType string    `json:"contentType,omitempty"`
+	Length      int64     `json:"length"`
+	Offset      int64     `json:"offset"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
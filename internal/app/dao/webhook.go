@@ -0,0 +1,50 @@
+package dao
+
+import "time"
+
+// WebhookRequest subscribes a URL to the document events of a user
+type WebhookRequest struct {
+	URL string `json:"url"`
+	// Events are the event types to deliver, all of them if empty
+	Events []string `json:"events"`
+	// Secret signs the deliveries, one is generated if empty
+	Secret string `json:"secret"`
+}
+
+// Webhook is a subscription to the document events of a user. The secret is only returned
+// when the webhook is created.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookEvent is a change of a document, the body of the deliveries
+type WebhookEvent struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Username   string    `json:"username"`
+	DocID      string    `json:"docId"`
+	Size       *int      `json:"size,omitempty"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// WebhookDelivery records the attempts to deliver an event to a webhook
+type WebhookDelivery struct {
+	ID        string       `json:"id"`
+	WebhookID string       `json:"webhookId"`
+	URL       string       `json:"url"`
+	Event     WebhookEvent `json:"event"`
+	Status    string       `json:"status"`
+	Attempts  int          `json:"attempts"`
+	// ResponseStatus is the HTTP status of the last attempt, 0 if it got no response
+	ResponseStatus int        `json:"responseStatus,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	NextAttemptAt  *time.Time `json:"nextAttemptAt,omitempty"`
+	DeliveredAt    *time.Time `json:"deliveredAt,omitempty"`
+	// ReplayOf is the delivery this one replays, if any
+	ReplayOf string `json:"replayOf,omitempty"`
+}
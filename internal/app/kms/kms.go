@@ -0,0 +1,71 @@
+package kms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// KMS wraps the data keys of documents with per-user key-encryption keys derived from
+// master keys it never reveals. Master keys are identified by an ID so they can be rotated.
+type KMS interface {
+	// CurrentKeyID returns the ID of the master key used to wrap new data keys
+	CurrentKeyID() string
+	// WrapKey encrypts a data key for a user with the current master key
+	WrapKey(username string, dataKey []byte) (wrapped []byte, keyID string, err error)
+	// UnwrapKey decrypts a data key wrapped for a user with the given master key
+	UnwrapKey(username, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Reloader is implemented by the KMS whose master keys can change from outside the broker
+type Reloader interface {
+	Reload() error
+}
+
+// ErrUnknownKey is returned when a data key was wrapped with a master key the KMS does not hold
+var ErrUnknownKey = errors.New("unknown master key")
+
+// Seal encrypts plaintext with AES-256-GCM, returning the nonce followed by the ciphertext
+func Seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open decrypts what Seal produced
+func Open(key, sealed, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// NewDataKey returns a random 256 bit key
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,178 @@
+package kms
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/hkdf"
+)
+
+// keyFile is the content of the local keyfile
+type keyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+// LocalKMS keeps its master keys in a local JSON keyfile, which should only be readable by the broker
+type LocalKMS struct {
+	mu   sync.RWMutex
+	path string
+	keys keyFile
+}
+
+// NewLocalKMS loads the keyfile at path, creating it with a first master key if it does not exist
+func NewLocalKMS(path string) (*LocalKMS, error) {
+	k := &LocalKMS{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	if k.keys.Current == "" {
+		log.Info("Creating master keyfile ", path)
+		if _, err := k.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// OpenLocalKMS loads the existing keyfile at path
+func OpenLocalKMS(path string) (*LocalKMS, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	k := &LocalKMS{path: path}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Reload reads the keyfile again, picking up master keys rotated by another process
+func (k *LocalKMS) Reload() error {
+	keys := keyFile{Keys: make(map[string][]byte)}
+	data, err := os.ReadFile(k.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return err
+		}
+		if _, ok := keys.Keys[keys.Current]; !ok {
+			return errors.New("keyfile current key " + keys.Current + " not found")
+		}
+	}
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+	return nil
+}
+
+// Rotate adds a new master key and makes it the current one. Older keys are kept to unwrap
+// the data keys that have not been wrapped again yet.
+func (k *LocalKMS) Rotate() (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	master, err := NewDataKey()
+	if err != nil {
+		return "", err
+	}
+	id := strconv.FormatInt(time.Now().UTC().UnixNano(), 36)
+	keys := keyFile{Current: id, Keys: map[string][]byte{id: master}}
+	for oldID, oldKey := range k.keys.Keys {
+		keys.Keys[oldID] = oldKey
+	}
+	if err := k.save(keys); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Retire removes a master key that is no longer current. The data keys wrapped with it
+// cannot be unwrapped afterwards, they must all have been wrapped again before.
+func (k *LocalKMS) Retire(keyID string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if _, ok := k.keys.Keys[keyID]; !ok {
+		return ErrUnknownKey
+	}
+	if keyID == k.keys.Current {
+		return errors.New("master key " + keyID + " is the current one")
+	}
+	keys := keyFile{Current: k.keys.Current, Keys: make(map[string][]byte)}
+	for id, key := range k.keys.Keys {
+		if id != keyID {
+			keys.Keys[id] = key
+		}
+	}
+	return k.save(keys)
+}
+
+// save atomically replaces the keyfile, the caller holds the write lock
+func (k *LocalKMS) save(keys keyFile) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(k.path), 0o700); err != nil {
+		return err
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, k.path); err != nil {
+		return err
+	}
+	k.keys = keys
+	return nil
+}
+
+func (k *LocalKMS) CurrentKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys.Current
+}
+
+func (k *LocalKMS) WrapKey(username string, dataKey []byte) ([]byte, string, error) {
+	keyID := k.CurrentKeyID()
+	kek, err := k.kek(username, keyID)
+	if err != nil {
+		return nil, "", err
+	}
+	wrapped, err := Seal(kek, dataKey, []byte(keyID))
+	return wrapped, keyID, err
+}
+
+func (k *LocalKMS) UnwrapKey(username, keyID string, wrapped []byte) ([]byte, error) {
+	kek, err := k.kek(username, keyID)
+	if err != nil {
+		return nil, err
+	}
+	return Open(kek, wrapped, []byte(keyID))
+}
+
+// kek derives the key-encryption key of a user from a master key with HKDF-SHA256
+func (k *LocalKMS) kek(username, keyID string) ([]byte, error) {
+	k.mu.RLock()
+	master, ok := k.keys.Keys[keyID]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	info := "seg-red-broker kek " + hex.EncodeToString([]byte(username))
+	kek := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, master, nil, []byte(info)), kek); err != nil {
+		return nil, err
+	}
+	return kek, nil
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// metric is a counter or a gauge, written in the Prometheus text exposition format
+type metric interface {
+	write(w io.Writer) error
+}
+
+var (
+	mu       sync.Mutex
+	registry = make(map[string]metric)
+)
+
+func register(name string, m metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := registry[name]; ok {
+		panic("metric " + name + " registered twice")
+	}
+	registry[name] = m
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	name, help string
+	value      atomic.Int64
+}
+
+// NewCounter creates and registers a counter
+func NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	register(name, c)
+	return c
+}
+
+// Add increases the counter by n
+func (c *Counter) Add(n int64) {
+	c.value.Add(n)
+}
+
+// Inc increases the counter by one
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", c.name, c.help, c.name, c.name, c.value.Load())
+	return err
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	name, help string
+	bits       atomic.Uint64
+}
+
+// NewGauge creates and registers a gauge
+func NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	register(name, g)
+	return g
+}
+
+// Set changes the value of the gauge
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	v := math.Float64frombits(g.bits.Load())
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", g.name, g.help, g.name, g.name, v)
+	return err
+}
+
+// WriteText writes every registered metric, sorted by name
+func WriteText(w io.Writer) error {
+	mu.Lock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	mu.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		mu.Lock()
+		m := registry[name]
+		mu.Unlock()
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
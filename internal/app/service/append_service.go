@@ -0,0 +1,119 @@
+package service
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"strconv"
+	"strings"
+)
+
+type AppendServiceImpl struct {
+	fs FileService
+	// locks serialise the appends to a document and its segments, by username and doc ID
+	locks keyLock
+}
+
+func NewAppendService(fs FileService) *AppendServiceImpl {
+	return &AppendServiceImpl{fs: fs}
+}
+
+type AppendService interface {
+	Append(username, docID string, doc *dao.Document, maxSize int, rollover bool) (*dao.FileSize, error)
+}
+
+// Append adds the content of doc at the end of a document, creating it if needed. Appends to a
+// document are serialised, and the write is conditional on the content it extends, so concurrent
+// writers never lose each other's data.
+//
+// With a maxSize, an append that would make the document larger is rejected, or written to a new
+// segment with rollover. Segments are named after the document, <doc ID>.1, <doc ID>.2 and so on,
+// and appends always go to the last one.
+func (svc *AppendServiceImpl) Append(username, docID string, doc *dao.Document, maxSize int, rollover bool) (*dao.FileSize, error) {
+	if maxSize < 0 {
+		return nil, common.BadRequestError("maxSize must not be negative")
+	}
+	if maxSize > 0 && len(doc.Content) > maxSize {
+		return nil, common.PayloadTooLargeError("the content to append is larger than maxSize")
+	}
+
+	// The lock of the document covers its segments too, for appends to agree on the last one
+	unlock := svc.locks.lock(username + "/" + docID)
+	defer unlock()
+	for attempt := 1; ; attempt++ {
+		// Another writer may have changed the document, or created the one appended to first
+		size, err := svc.appendOnce(username, docID, doc, maxSize, rollover)
+		if err == nil || attempt == maxWriteAttempts || !(isPreconditionFailed(err) || common.ToAPIError(err).StatusCode == http.StatusConflict) {
+			return size, err
+		}
+	}
+}
+
+func (svc *AppendServiceImpl) appendOnce(username, docID string, doc *dao.Document, maxSize int, rollover bool) (*dao.FileSize, error) {
+	target, segment := docID, 0
+	if rollover {
+		var err error
+		if target, segment, err = svc.lastSegment(username, docID); err != nil {
+			return nil, err
+		}
+	}
+
+	current, err := svc.fs.GetFileWithKey(username, target, doc.CustomerKey)
+	if err != nil && common.ToAPIError(err).StatusCode != http.StatusNotFound {
+		return nil, err
+	}
+	if current == nil {
+		return svc.create(username, target, doc)
+	}
+
+	if maxSize > 0 && len(current.Content)+len(doc.Content) > maxSize {
+		if !rollover {
+			return nil, common.PayloadTooLargeError("document " + target + " would be larger than maxSize")
+		}
+		return svc.create(username, docID+"."+strconv.Itoa(segment+1), doc)
+	}
+
+	// The stored content type and expiry are kept
+	size, err := svc.fs.UpdateFile(username, target, &dao.Document{
+		Content:     append(current.Content, doc.Content...),
+		Metadata:    dao.FileMetadata{ContentType: current.Metadata.ContentType},
+		CustomerKey: doc.CustomerKey,
+		IfMatch:     ETag(current),
+	})
+	if err != nil {
+		return nil, err
+	}
+	size.DocID = target
+	return size, nil
+}
+
+func (svc *AppendServiceImpl) create(username, docID string, doc *dao.Document) (*dao.FileSize, error) {
+	size, err := svc.fs.CreateFile(username, docID, doc)
+	if err != nil {
+		return nil, err
+	}
+	size.DocID = docID
+	return size, nil
+}
+
+// lastSegment returns the segment appends to docID go to, with its number, 0 for docID itself
+func (svc *AppendServiceImpl) lastSegment(username, docID string) (string, int, error) {
+	docs, err := svc.fs.GetUserDocSizes(username)
+	if err != nil {
+		return "", 0, err
+	}
+	last := 0
+	for id := range docs {
+		suffix, ok := strings.CutPrefix(id, docID+".")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(suffix); err == nil && n > last && strconv.Itoa(n) == suffix {
+			last = n
+		}
+	}
+	if last == 0 {
+		return docID, 0, nil
+	}
+	return docID + "." + strconv.Itoa(last), last, nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"seg-red-broker/internal/app/dao"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAppendConcurrentWriters(t *testing.T) {
+	fs, _ := newTestFileService(t)
+	svc := NewAppendService(fs)
+	if _, err := fs.CreateFile("ana", "log", &dao.Document{Content: []byte{}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Appends race with conditional rewrites of the content, which must not make any append get lost
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := svc.Append("ana", "log", &dao.Document{Content: []byte("x")}, 0, false); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for {
+				current, err := fs.GetFile("ana", "log")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				_, err = fs.UpdateFile("ana", "log", &dao.Document{Content: current.Content, IfMatch: ETag(current)})
+				if !isPreconditionFailed(err) {
+					if err != nil {
+						t.Error(err)
+					}
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	doc, err := fs.GetFile("ana", "log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(doc.Content) != strings.Repeat("x", 20) {
+		t.Fatalf("content %q after 20 appends, want 20 x", doc.Content)
+	}
+}
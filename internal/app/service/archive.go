@@ -0,0 +1,142 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// Archive formats supported by exports and imports
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// archiveWriter writes the entries of an archive one after the other
+type archiveWriter interface {
+	Add(name string, content []byte, modTime time.Time) error
+	Close() error
+}
+
+func newArchiveWriter(format string, w io.Writer) archiveWriter {
+	if format == ArchiveTarGz {
+		gz := gzip.NewWriter(w)
+		return &tarGzWriter{gz: gz, tw: tar.NewWriter(gz)}
+	}
+	return &zipWriter{zw: zip.NewWriter(w)}
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipWriter) Add(name string, content []byte, modTime time.Time) error {
+	f, err := z.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.zw.Close()
+}
+
+type tarGzWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (t *tarGzWriter) Add(name string, content []byte, modTime time.Time) error {
+	header := &tar.Header{
+		Name:     name,
+		Mode:     0o644,
+		Size:     int64(len(content)),
+		ModTime:  modTime,
+		Typeflag: tar.TypeReg,
+	}
+	if err := t.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := t.tw.Write(content)
+	return err
+}
+
+func (t *tarGzWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+// archiveVisitor receives every entry of an archive. Only regular files come with a reader.
+type archiveVisitor func(name string, isDir, isRegular bool, r io.Reader) error
+
+// detectArchive tells the format of an archive from its magic bytes
+func detectArchive(archive io.ReaderAt) (string, bool) {
+	magic := make([]byte, 4)
+	n, _ := archive.ReadAt(magic, 0)
+	switch {
+	case n >= 4 && string(magic) == "PK\x03\x04":
+		return ArchiveZip, true
+	case n >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return ArchiveTarGz, true
+	}
+	return "", false
+}
+
+// walkArchive calls visit for every entry of the archive, in archive order
+func walkArchive(format string, archive io.ReaderAt, size int64, visit archiveVisitor) error {
+	if format == ArchiveZip {
+		zr, err := zip.NewReader(archive, size)
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if err := visitZipFile(f, visit); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	gz, err := gzip.NewReader(io.NewSectionReader(archive, 0, size))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		isRegular := header.Typeflag == tar.TypeReg
+		var r io.Reader
+		if isRegular {
+			r = tr
+		}
+		if err := visit(header.Name, header.Typeflag == tar.TypeDir, isRegular, r); err != nil {
+			return err
+		}
+	}
+}
+
+func visitZipFile(f *zip.File, visit archiveVisitor) error {
+	mode := f.Mode()
+	if !mode.IsRegular() {
+		return visit(f.Name, mode.IsDir(), false, nil)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return visit(f.Name, false, true, rc)
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"net/http"
+	"os"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/store"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Outcomes of audited requests
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// maxAuditResults is the most entries an audit query returns
+const maxAuditResults = 1000
+
+type AuditServiceImpl struct {
+	as *store.AuditStore
+	// admins are the users allowed to query the audit log, from AUDIT_ADMINS
+	admins map[string]bool
+}
+
+func NewAuditService(as *store.AuditStore) *AuditServiceImpl {
+	svc := &AuditServiceImpl{as: as, admins: make(map[string]bool)}
+	for _, username := range strings.Split(os.Getenv("AUDIT_ADMINS"), ",") {
+		if username = strings.TrimSpace(username); username != "" {
+			svc.admins[username] = true
+		}
+	}
+	return svc
+}
+
+type AuditService interface {
+	Record(entry dao.AuditEntry)
+	Query(q dao.AuditQuery) ([]dao.AuditEntry, error)
+	IsAdmin(username string) bool
+}
+
+// Record appends an entry to the audit log. The request has already been answered by then,
+// a failure to record it is only logged.
+func (svc *AuditServiceImpl) Record(entry dao.AuditEntry) {
+	entry.Outcome = AuditSuccess
+	if entry.Status >= http.StatusBadRequest {
+		entry.Outcome = AuditFailure
+	}
+	if err := svc.as.Append(entry); err != nil {
+		log.Errorf("Error writing audit entry of request %s: %v", entry.RequestID, err)
+	}
+}
+
+// Query returns the most recent entries matching q, up to its limit
+func (svc *AuditServiceImpl) Query(q dao.AuditQuery) ([]dao.AuditEntry, error) {
+	if q.Limit <= 0 || q.Limit > maxAuditResults {
+		q.Limit = maxAuditResults
+	}
+	return svc.as.Query(func(entry *dao.AuditEntry) bool {
+		owner, docID, _ := strings.Cut(entry.Target, "/")
+		switch {
+		case q.User != "" && entry.Actor != q.User && owner != q.User:
+			return false
+		case q.DocID != "" && docID != q.DocID:
+			return false
+		case q.From != nil && entry.Time.Before(*q.From):
+			return false
+		case q.To != nil && !entry.Time.Before(*q.To):
+			return false
+		}
+		return true
+	}, q.Limit)
+}
+
+// IsAdmin checks if a user can query the audit log
+func (svc *AuditServiceImpl) IsAdmin(username string) bool {
+	return svc.admins[username]
+}
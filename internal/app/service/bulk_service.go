@@ -0,0 +1,145 @@
+package service
+
+import (
+	"encoding/base64"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"sync"
+	"unicode/utf8"
+)
+
+// Bulk operation names
+const (
+	BulkGet    = "get"
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+type BulkServiceImpl struct {
+	fs          FileService
+	concurrency int
+}
+
+func NewBulkService(fs FileService) *BulkServiceImpl {
+	concurrency := int(common.GetEnvInt64("BULK_CONCURRENCY", 8))
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &BulkServiceImpl{fs: fs, concurrency: concurrency}
+}
+
+type BulkService interface {
+	Execute(username string, ops []dao.BulkOperation) []dao.BulkResult
+}
+
+// Execute runs the operations against the FileService with bounded concurrency.
+// Operations on the same document run one after the other in request order,
+// so that a batch can for instance create and then update a document.
+func (svc *BulkServiceImpl) Execute(username string, ops []dao.BulkOperation) []dao.BulkResult {
+	results := make([]dao.BulkResult, len(ops))
+
+	// Group the operations by document, keeping the order of first appearance
+	var order []string
+	groups := make(map[string][]int)
+	for i, op := range ops {
+		key := op.DocID
+		if docID, apiErr := NormalizeDocID(op.DocID); apiErr == nil {
+			key = docID
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], i)
+	}
+
+	sem := make(chan struct{}, svc.concurrency)
+	var wg sync.WaitGroup
+	for _, docID := range order {
+		indexes := groups[docID]
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			for _, i := range indexes {
+				results[i] = svc.execute(username, ops[i])
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (svc *BulkServiceImpl) execute(username string, op dao.BulkOperation) dao.BulkResult {
+	result := dao.BulkResult{Op: op.Op, DocID: op.DocID, Status: http.StatusOK}
+	if op.DocID == "" {
+		return failed(result, common.EmptyParamsError("docId"))
+	}
+	docID, apiErr := NormalizeDocID(op.DocID)
+	if apiErr != nil {
+		return failed(result, apiErr)
+	}
+	result.DocID = docID
+
+	switch op.Op {
+	case BulkGet:
+		doc, err := svc.fs.GetFile(username, docID)
+		if err != nil {
+			return failed(result, err)
+		}
+		content := string(doc.Content)
+		if !utf8.Valid(doc.Content) {
+			content = base64.StdEncoding.EncodeToString(doc.Content)
+			result.Encoding = EncodingBase64
+		}
+		result.Content = &content
+	case BulkCreate, BulkUpdate:
+		doc, err := bulkDocument(op)
+		if err != nil {
+			return failed(result, err)
+		}
+		var size *dao.FileSize
+		if op.Op == BulkCreate {
+			size, err = svc.fs.CreateFile(username, docID, doc)
+		} else {
+			size, err = svc.fs.UpdateFile(username, docID, doc)
+		}
+		if err != nil {
+			return failed(result, err)
+		}
+		result.Size = &size.Size
+	case BulkDelete:
+		if err := svc.fs.DeleteFile(username, docID); err != nil {
+			return failed(result, err)
+		}
+	default:
+		return failed(result, common.BadRequestError("unknown operation "+op.Op))
+	}
+	return result
+}
+
+// bulkDocument decodes the content of a create or update operation
+func bulkDocument(op dao.BulkOperation) (*dao.Document, error) {
+	content := []byte(op.Content)
+	switch op.Encoding {
+	case "":
+	case EncodingBase64:
+		var err error
+		if content, err = base64.StdEncoding.DecodeString(op.Content); err != nil {
+			return nil, common.BadRequestError("content is not valid base64")
+		}
+	default:
+		return nil, common.BadRequestError("unknown encoding " + op.Encoding)
+	}
+	return &dao.Document{Content: content, Metadata: dao.FileMetadata{ContentType: op.ContentType}}, nil
+}
+
+func failed(result dao.BulkResult, err error) dao.BulkResult {
+	result.Error = common.PublicError(err)
+	result.Status = result.Error.StatusCode
+	return result
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChangeReset tells a client resuming a change feed that the events it missed are no longer
+// in the log, and that it has to list the documents again
+const ChangeReset = "reset"
+
+// changeBuffer is the number of events a subscriber can fall behind before it is disconnected
+const changeBuffer = 64
+
+type ChangeServiceImpl struct {
+	mu sync.Mutex
+	// epoch prefixes the event IDs, as the sequence numbers start over when the broker restarts
+	epoch   string
+	logSize int
+	feeds   map[string]*changeFeed
+}
+
+// changeFeed is the event log of a user, numbered from 1, and the channels of its subscribers
+type changeFeed struct {
+	seq         uint64
+	events      []dao.ChangeEvent
+	subscribers map[chan dao.ChangeEvent]bool
+}
+
+// NewChangeService creates a ChangeService keeping the last CHANGES_LOG_SIZE events of every user
+func NewChangeService() *ChangeServiceImpl {
+	logSize := int(common.GetEnvInt64("CHANGES_LOG_SIZE", 1000))
+	if logSize < 0 {
+		logSize = 0
+	}
+	return &ChangeServiceImpl{
+		epoch:   strconv.FormatInt(time.Now().UnixNano(), 36),
+		logSize: logSize,
+		feeds:   make(map[string]*changeFeed),
+	}
+}
+
+type ChangeService interface {
+	FileListener
+	Subscribe(username, lastEventID string) ([]dao.ChangeEvent, <-chan dao.ChangeEvent, func())
+}
+
+func (svc *ChangeServiceImpl) FileWritten(username, docID string, doc *dao.Document, created bool) {
+	eventType := EventDocumentUpdated
+	if created {
+		eventType = EventDocumentCreated
+	}
+	size := doc.Metadata.Size
+	svc.publish(username, dao.ChangeEvent{Type: eventType, DocID: docID, Size: &size})
+}
+
+func (svc *ChangeServiceImpl) FileDeleted(username, docID string) {
+	svc.publish(username, dao.ChangeEvent{Type: EventDocumentDeleted, DocID: docID})
+}
+
+// Subscribe returns the events of a user after lastEventID and a channel receiving the next
+// ones until the returned function is called. If the events after lastEventID are no longer in
+// the log, a reset event comes first. The channel is closed if the subscriber falls behind.
+func (svc *ChangeServiceImpl) Subscribe(username, lastEventID string) ([]dao.ChangeEvent, <-chan dao.ChangeEvent, func()) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	feed := svc.feed(username)
+
+	backlog := make([]dao.ChangeEvent, 0)
+	if lastEventID != "" {
+		if seq, ok := svc.parseEventID(lastEventID); ok && seq <= feed.seq && seq+uint64(len(feed.events)) >= feed.seq {
+			backlog = append(backlog, feed.events[len(feed.events)-int(feed.seq-seq):]...)
+		} else {
+			backlog = append(backlog, dao.ChangeEvent{ID: svc.eventID(feed.seq), Type: ChangeReset, OccurredAt: time.Now().UTC()})
+		}
+	}
+
+	ch := make(chan dao.ChangeEvent, changeBuffer)
+	feed.subscribers[ch] = true
+	cancel := func() {
+		svc.mu.Lock()
+		defer svc.mu.Unlock()
+		if feed.subscribers[ch] {
+			delete(feed.subscribers, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel
+}
+
+func (svc *ChangeServiceImpl) publish(username string, event dao.ChangeEvent) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	feed := svc.feed(username)
+	feed.seq++
+	event.ID = svc.eventID(feed.seq)
+	event.OccurredAt = time.Now().UTC()
+	feed.events = append(feed.events, event)
+	if len(feed.events) > svc.logSize {
+		feed.events = append([]dao.ChangeEvent(nil), feed.events[len(feed.events)-svc.logSize:]...)
+	}
+	for ch := range feed.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// The subscriber can resume from the last event it got
+			delete(feed.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (svc *ChangeServiceImpl) feed(username string) *changeFeed {
+	feed, ok := svc.feeds[username]
+	if !ok {
+		feed = &changeFeed{subscribers: make(map[chan dao.ChangeEvent]bool)}
+		svc.feeds[username] = feed
+	}
+	return feed
+}
+
+func (svc *ChangeServiceImpl) eventID(seq uint64) string {
+	return svc.epoch + "-" + strconv.FormatUint(seq, 10)
+}
+
+// parseEventID returns the sequence number of an event ID of this epoch
+func (svc *ChangeServiceImpl) parseEventID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != svc.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
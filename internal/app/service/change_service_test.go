@@ -0,0 +1,43 @@
+package service
+
+import (
+	"seg-red-broker/internal/app/dao"
+	"testing"
+)
+
+func TestChangeEventsTellCreatesFromUpdates(t *testing.T) {
+	fs, backend, trash, _ := newTestTrash(t)
+	svc := NewChangeService()
+	fs.AddListener(svc)
+	_, events, cancel := svc.Subscribe("ana", "")
+	defer cancel()
+
+	if _, err := fs.CreateFile("ana", "doc", &dao.Document{Content: []byte("one")}); err != nil {
+		t.Fatal(err)
+	}
+	// Stored before the broker kept metadata, its first update is not a creation
+	backend.Put("ana", "legacy", "old content")
+	if _, err := fs.UpdateFile("ana", "legacy", &dao.Document{Content: []byte("new content")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteFile("ana", "doc"); err != nil {
+		t.Fatal(err)
+	}
+	// A restored document is created again
+	if _, err := trash.Restore("ana", trash.List("ana")[0].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []dao.ChangeEvent{
+		{Type: EventDocumentCreated, DocID: "doc"},
+		{Type: EventDocumentUpdated, DocID: "legacy"},
+		{Type: EventDocumentDeleted, DocID: "doc"},
+		{Type: EventDocumentCreated, DocID: "doc"},
+	}
+	for _, w := range want {
+		got := <-events
+		if got.Type != w.Type || got.DocID != w.DocID {
+			t.Fatalf("event %s %s, want %s %s", got.Type, got.DocID, w.Type, w.DocID)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/metrics"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	reaperRuns = metrics.NewCounter("broker_expiry_reaper_runs_total",
+		"Runs of the reaper deleting expired documents")
+	reaperDeleted = metrics.NewCounter("broker_expiry_documents_deleted_total",
+		"Expired documents deleted by the reaper")
+	reaperErrors = metrics.NewCounter("broker_expiry_delete_errors_total",
+		"Expired documents the reaper failed to delete")
+	reaperLastRun = metrics.NewGauge("broker_expiry_reaper_last_run_timestamp_seconds",
+		"Unix time of the last run of the reaper")
+	reaperLastDuration = metrics.NewGauge("broker_expiry_reaper_last_run_duration_seconds",
+		"Duration of the last run of the reaper")
+)
+
+type ExpiryServiceImpl struct {
+	fs *FileServiceImpl
+}
+
+// NewExpiryService creates an ExpiryService reaping the expired documents every EXPIRY_REAP_INTERVAL
+func NewExpiryService(fs *FileServiceImpl) *ExpiryServiceImpl {
+	svc := &ExpiryServiceImpl{fs: fs}
+	go svc.reapEvery(common.GetEnvDuration("EXPIRY_REAP_INTERVAL", time.Minute))
+	return svc
+}
+
+type ExpiryService interface {
+	ReapExpired() int
+}
+
+// ReapExpired deletes every expired document for good, they do not go to the trash, and
+// returns how many were deleted. Documents failing are tried again on the next run.
+func (svc *ExpiryServiceImpl) ReapExpired() int {
+	start := time.Now()
+	deleted, failed := 0, 0
+	for _, username := range svc.fs.ms.Usernames() {
+		for docID, meta := range svc.fs.ms.List(username) {
+			if !expired(&meta) {
+				continue
+			}
+			reaped, err := svc.reap(username, docID)
+			if !reaped {
+				continue
+			}
+			if err != nil && common.ToAPIError(err).StatusCode != http.StatusNotFound {
+				log.Errorf("Error deleting expired document %s/%s: %v", username, docID, err)
+				failed++
+				continue
+			}
+			log.Infof("Deleted expired document %s/%s, expired at %s", username, docID, meta.ExpiresAt.Format(time.RFC3339))
+			deleted++
+		}
+	}
+
+	reaperRuns.Inc()
+	reaperDeleted.Add(int64(deleted))
+	reaperErrors.Add(int64(failed))
+	reaperLastRun.Set(float64(start.Unix()))
+	reaperLastDuration.Set(time.Since(start).Seconds())
+	if deleted > 0 || failed > 0 {
+		log.Infof("Reaper deleted %d expired documents, %d failed, in %s", deleted, failed, time.Since(start))
+	}
+	return deleted
+}
+
+// reap removes an expired document unless it has been written again since it was listed.
+// It goes through the unexported removeFile of the file service rather than DeleteFile, which
+// would move the document to the trash, but the listeners are notified all the same: the quota,
+// the search index, the change feed and the webhooks see a deletion like any other.
+func (svc *ExpiryServiceImpl) reap(username, docID string) (bool, error) {
+	unlock := svc.fs.lockDocument(username, docID)
+	defer unlock()
+	meta, ok := svc.fs.ms.Get(username, docID)
+	if !ok || !expired(meta) {
+		return false, nil
+	}
+	return true, svc.fs.removeFile(username, docID)
+}
+
+func (svc *ExpiryServiceImpl) reapEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		svc.ReapExpired()
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/store"
+	"testing"
+	"time"
+)
+
+// expire makes a document expire a minute ago
+func expire(t *testing.T, fs *FileServiceImpl, docID string) {
+	t.Helper()
+	err := fs.ms.Update("ana", docID, func(meta *dao.FileMetadata) bool {
+		expiredAt := time.Now().Add(-time.Minute)
+		meta.ExpiresAt = &expiredAt
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReapExpiredSkipsTrash(t *testing.T) {
+	fs, backend, trash, _ := newTestTrash(t)
+	svc := &ExpiryServiceImpl{fs: fs}
+	for _, docID := range []string{"old", "new"} {
+		if _, err := fs.CreateFile("ana", docID, &dao.Document{Content: []byte("content")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expire(t, fs, "old")
+
+	if deleted := svc.ReapExpired(); deleted != 1 {
+		t.Fatalf("ReapExpired deleted %d documents, want 1", deleted)
+	}
+	if _, ok := backend.Stored("ana", "old"); ok {
+		t.Fatal("the expired document is still stored")
+	}
+	if _, ok := backend.Stored("ana", "new"); !ok {
+		t.Fatal("a document that has not expired was deleted")
+	}
+	if items := trash.List("ana"); len(items) != 0 {
+		t.Fatalf("the reaper moved %d documents to the trash, want none", len(items))
+	}
+}
+
+func TestReapExpiredNotifiesListeners(t *testing.T) {
+	fs, _, _, qs := newTestTrash(t)
+	ss := NewSearchService(fs, store.NewSearchStore())
+	fs.AddListener(ss)
+	webhooks := NewWebhookService(store.NewWebhookStore())
+	webhooks.allowPrivate = true
+	webhooks.client = webhooks.newClient(2 * time.Second)
+	fs.AddListener(webhooks)
+	receiver := &fakeReceiver{}
+	webhook := subscribeTestWebhook(t, webhooks, receiver)
+	if _, err := fs.CreateFile("ana", "old", &dao.Document{Content: []byte("expiring content")}); err != nil {
+		t.Fatal(err)
+	}
+	expire(t, fs, "old")
+
+	if deleted := (&ExpiryServiceImpl{fs: fs}).ReapExpired(); deleted != 1 {
+		t.Fatalf("ReapExpired deleted %d documents, want 1", deleted)
+	}
+	if used, trashed := usedBytes(t, qs, "ana"); used != 0 || trashed != 0 {
+		t.Fatalf("usage %d bytes and %d in the trash after reaping, want none", used, trashed)
+	}
+	if docIDs := searchDocIDs(t, ss, "expiring"); len(docIDs) != 0 {
+		t.Fatalf("search found %v after reaping, want nothing", docIDs)
+	}
+	deliveries := settled(t, webhooks, webhook.ID, 2)
+	if deliveries[0].Event.Type != EventDocumentDeleted && deliveries[1].Event.Type != EventDocumentDeleted {
+		t.Fatalf("webhook deliveries %+v, want a deletion", deliveries)
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"time"
+)
+
+// Names of the entries of an export archive
+const (
+	ExportManifestName = "manifest.json"
+	ExportDocumentsDir = "documents/"
+)
+
+type ExportServiceImpl struct {
+	fs FileService
+}
+
+func NewExportService(fs FileService) *ExportServiceImpl {
+	return &ExportServiceImpl{fs}
+}
+
+type ExportService interface {
+	Export(username, format string, w io.Writer) (*dao.ExportManifest, error)
+}
+
+// Export streams an archive with every document of a user followed by a JSON manifest.
+// The documents are listed as GetAllUserDocs lists them, those stored before the broker kept
+// metadata included, and each one is fetched once and written before the next, so the archive
+// is never held in memory. The manifest is returned as well, listing the documents already
+// written if the export fails part way.
+func (svc *ExportServiceImpl) Export(username, format string, w io.Writer) (*dao.ExportManifest, error) {
+	manifest := &dao.ExportManifest{
+		Username:   username,
+		ExportedAt: time.Now().UTC(),
+		Documents:  make([]dao.ExportEntry, 0),
+	}
+	docIDs, err := svc.fs.ListDocIDs(username)
+	if err != nil {
+		return manifest, err
+	}
+
+	archive := newArchiveWriter(format, w)
+	for _, docID := range docIDs {
+		entry := dao.ExportEntry{DocID: docID}
+		doc, err := svc.fs.GetFile(username, docID)
+		if err != nil {
+			// Documents deleted or failing while exporting are reported in the manifest
+			entry.Error = common.PublicError(err)
+			manifest.Documents = append(manifest.Documents, entry)
+			continue
+		}
+		entry.Path = ExportDocumentsDir + docID
+		entry.ContentType = doc.Metadata.ContentType
+		entry.Size = len(doc.Content)
+		entry.CreatedAt = doc.Metadata.CreatedAt
+		entry.UpdatedAt = doc.Metadata.UpdatedAt
+		if err := archive.Add(entry.Path, doc.Content, modTime(doc.Metadata.UpdatedAt)); err != nil {
+			return manifest, err
+		}
+		manifest.Documents = append(manifest.Documents, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, err
+	}
+	if err := archive.Add(ExportManifestName, data, manifest.ExportedAt); err != nil {
+		return manifest, err
+	}
+	return manifest, archive.Close()
+}
+
+// modTime returns t, or now for documents created before the broker tracked metadata
+func modTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return time.Now()
+	}
+	return t
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"seg-red-broker/internal/app/dao"
+	"testing"
+)
+
+func TestExportEveryDocument(t *testing.T) {
+	fs, backend := newTestFileService(t)
+	fs.AddValidator(newTestScanService(ScanOutcomeQuarantine, &fakeScanner{category: ScanCategoryMalware, match: "EICAR"}))
+	if _, err := fs.CreateFile("ana", "notes/todo", &dao.Document{Content: []byte("milk")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.CreateFile("ana", "infected", &dao.Document{Content: []byte("EICAR")}); err != nil {
+		t.Fatal(err)
+	}
+	// Stored before the broker kept metadata
+	backend.Put("ana", "legacy", "old content")
+
+	var archive bytes.Buffer
+	if _, err := NewExportService(fs).Export("ana", ArchiveZip, &archive); err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]string)
+	err := walkArchive(ArchiveZip, bytes.NewReader(archive.Bytes()), int64(archive.Len()), func(name string, isDir, isRegular bool, r io.Reader) error {
+		content, err := io.ReadAll(r)
+		entries[name] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries[ExportDocumentsDir+"notes/todo"] != "milk" || entries[ExportDocumentsDir+"legacy"] != "old content" {
+		t.Fatalf("archive entries %v, want the nested and the legacy documents", entries)
+	}
+	if _, ok := entries[ExportDocumentsDir+"infected"]; ok {
+		t.Fatal("the quarantined document was exported")
+	}
+	var manifest dao.ExportManifest
+	if err := json.Unmarshal([]byte(entries[ExportManifestName]), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Documents) != 2 || manifest.Documents[0].DocID != "legacy" || manifest.Documents[0].Size != len("old content") {
+		t.Fatalf("manifest %+v, want the two exported documents", manifest.Documents)
+	}
+}
@@ -1,42 +1,587 @@
 package service
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
 	"seg-red-broker/internal/app/client"
+	"seg-red-broker/internal/app/common"
 	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/kms"
+	"seg-red-broker/internal/app/store"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
 )
 
+// EncodingBase64 marks documents whose content is sent base64 encoded to the file service
+const EncodingBase64 = "base64"
+
+// EncryptionAES256GCM is the algorithm documents are encrypted with
+const EncryptionAES256GCM = "AES-256-GCM"
+
 type FileServiceImpl struct {
-	fc client.FileClient
+	fc         client.FileClient
+	ms         *store.MetadataStore
+	validators []FileValidator
+	listeners  []FileListener
+	// compression is applied to documents of at least compressionMinSize bytes before they are stored
+	compression        string
+	compressionMinSize int
+	// kms wraps the data keys of encrypted documents, documents are stored in plaintext without it
+	kms kms.KMS
+	// trash keeps deleted documents until they are restored or purged, they are removed without it
+	trash *TrashServiceImpl
+	// locks serialise the read-modify-write operations on a document, by username and doc ID
+	locks keyLock
+}
+
+func NewFileService(fc client.FileClient, ms *store.MetadataStore) *FileServiceImpl {
+	compression := os.Getenv("STORAGE_COMPRESSION")
+	if compression != "" && !common.IsCompression(compression) {
+		log.Warnf("Unsupported storage compression %q, documents are stored uncompressed", compression)
+		compression = ""
+	}
+	return &FileServiceImpl{
+		fc:                 fc,
+		ms:                 ms,
+		compression:        compression,
+		compressionMinSize: int(common.GetEnvInt64("STORAGE_COMPRESSION_MIN_SIZE", 1024)),
+	}
+}
+
+// EnableEncryption encrypts every later document write with a data key wrapped by k and starts
+// rewrapping the data keys periodically. Documents stored before keep being read as they are.
+func (fs *FileServiceImpl) EnableEncryption(k kms.KMS) {
+	fs.kms = k
+	go fs.rewrapEvery(common.GetEnvDuration("ENCRYPTION_REWRAP_INTERVAL", time.Hour))
+}
+
+// EnableTrash makes DeleteFile move documents to the trash instead of removing them
+func (fs *FileServiceImpl) EnableTrash(trash *TrashServiceImpl) {
+	fs.trash = trash
+}
+
+// FileValidator can reject a document before it is sent to the file service
+type FileValidator interface {
+	ValidateFile(username, docID string, doc *dao.Document) error
+}
+
+// AddValidator registers a validator for every later document write
+func (fs *FileServiceImpl) AddValidator(v FileValidator) {
+	fs.validators = append(fs.validators, v)
+}
+
+// FileListener is notified after a document change has been stored by the file service.
+// FileWritten is told whether the write created the document or replaced an existing one.
+type FileListener interface {
+	FileWritten(username, docID string, doc *dao.Document, created bool)
+	FileDeleted(username, docID string)
 }
 
-func NewFileService(fc client.FileClient) *FileServiceImpl {
-	return &FileServiceImpl{fc}
+// AddListener registers a listener for every later document change
+func (fs *FileServiceImpl) AddListener(l FileListener) {
+	fs.listeners = append(fs.listeners, l)
 }
 
 type FileService interface {
-	GetFile(username, docID string) (*dao.FileContent, error)
-	CreateFile(username, docID string, content []byte) (*dao.FileSize, error)
-	UpdateFile(username, docID string, content []byte) (*dao.FileSize, error)
+	GetFile(username, docID string) (*dao.Document, error)
+	GetFileWithKey(username, docID string, customerKey []byte) (*dao.Document, error)
+	CreateFile(username, docID string, doc *dao.Document) (*dao.FileSize, error)
+	UpdateFile(username, docID string, doc *dao.Document) (*dao.FileSize, error)
 	DeleteFile(username, docID string) error
+	RemoveFile(username, docID string) error
 	GetAllUserDocs(username string) (*map[string]string, error)
+	ListDocIDs(username string) ([]string, error)
+	GetUserDocSizes(username string) (map[string]int, error)
+	RecordChecksum(username, docID string, content []byte) error
+	GetLabels(username, docID string) (*dao.DocumentLabels, error)
+	SetLabels(username, docID string, labels *dao.DocumentLabels) error
+	FindUserDocs(username string, selector *LabelSelector) (*map[string]string, error)
 }
 
-func (fs *FileServiceImpl) GetFile(username, docID string) (*dao.FileContent, error) {
-	return fs.fc.GetFile(username, docID)
+// lockDocument serialises the writes to a document, so that If-Match and the metadata an update
+// keeps are checked against the document it replaces. It returns the function releasing the lock.
+func (fs *FileServiceImpl) lockDocument(username, docID string) func() {
+	return fs.locks.lock(username + "/" + docID)
 }
 
-func (fs *FileServiceImpl) CreateFile(username, docID string, content []byte) (*dao.FileSize, error) {
-	return fs.fc.CreateFile(username, docID, content)
+// GetFile returns the decoded content of a document and its metadata
+func (fs *FileServiceImpl) GetFile(username, docID string) (*dao.Document, error) {
+	return fs.GetFileWithKey(username, docID, nil)
 }
 
-func (fs *FileServiceImpl) UpdateFile(username, docID string, content []byte) (*dao.FileSize, error) {
-	return fs.fc.UpdateFile(username, docID, content)
+// GetFileWithKey returns a document that may be encrypted with a customer key
+func (fs *FileServiceImpl) GetFileWithKey(username, docID string, customerKey []byte) (*dao.Document, error) {
+	meta, ok := fs.ms.Get(username, docID)
+	if ok && expired(meta) {
+		return nil, common.NotFoundError("document not found")
+	}
+	content, err := fs.fc.GetFile(username, docID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		meta = &dao.FileMetadata{Size: len(content.Content)}
+	}
+	if meta.Scan != nil && meta.Scan.Outcome == ScanOutcomeQuarantine {
+		return nil, common.QuarantinedError(meta.Scan)
+	}
+	raw, err := fs.decodeContent(username, docID, content.Content, *meta, customerKey)
+	if err != nil {
+		return nil, err
+	}
+	doc := &dao.Document{Content: raw, Metadata: *meta}
+	if meta.Encryption != nil && meta.Encryption.CustomerKey {
+		doc.CustomerKey = customerKey
+	}
+	return doc, nil
 }
 
+func (fs *FileServiceImpl) CreateFile(username, docID string, doc *dao.Document) (*dao.FileSize, error) {
+	unlock := fs.lockDocument(username, docID)
+	defer unlock()
+	if err := fs.validate(username, docID, doc); err != nil {
+		return nil, err
+	}
+	// An expired document the reaper has not deleted yet is already gone for the user
+	if old, ok := fs.ms.Get(username, docID); ok && expired(old) {
+		if err := fs.removeFile(username, docID); err != nil {
+			return nil, err
+		}
+	}
+	meta := newMetadata(doc)
+	stored, err := fs.encodeContent(username, docID, doc, &meta)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.fc.CreateFile(username, docID, stored); err != nil {
+		return nil, err
+	}
+	if err := fs.ms.Put(username, docID, meta); err != nil {
+		return nil, err
+	}
+	fs.notifyWritten(username, docID, &dao.Document{Content: doc.Content, Metadata: meta}, true)
+	return &dao.FileSize{Size: meta.Size}, nil
+}
+
+// UpdateFile replaces the content of a document. The content type, expiry, tags and labels
+// not set in doc are kept, and with doc.IfMatch the document must not have changed since it was read.
+func (fs *FileServiceImpl) UpdateFile(username, docID string, doc *dao.Document) (*dao.FileSize, error) {
+	unlock := fs.lockDocument(username, docID)
+	defer unlock()
+	if doc.IfMatch != "" {
+		current, err := fs.GetFileWithKey(username, docID, doc.CustomerKey)
+		if err != nil {
+			return nil, err
+		}
+		if !MatchETag(doc.IfMatch, ETag(current)) {
+			return nil, common.PreconditionFailedError("document has changed, its ETag does not match If-Match")
+		}
+	}
+	if err := fs.validate(username, docID, doc); err != nil {
+		return nil, err
+	}
+	meta := newMetadata(doc)
+	if old, ok := fs.ms.Get(username, docID); ok {
+		if expired(old) {
+			return nil, common.NotFoundError("document not found")
+		}
+		meta.CreatedAt = old.CreatedAt
+		if meta.ContentType == "" {
+			meta.ContentType = old.ContentType
+		}
+		if meta.ExpiresAt == nil {
+			meta.ExpiresAt = old.ExpiresAt
+		}
+		if meta.Tags == nil {
+			meta.Tags = old.Tags
+		}
+		if meta.Labels == nil {
+			meta.Labels = old.Labels
+		}
+	}
+	stored, err := fs.encodeContent(username, docID, doc, &meta)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fs.fc.UpdateFile(username, docID, stored); err != nil {
+		return nil, err
+	}
+	if err := fs.ms.Put(username, docID, meta); err != nil {
+		return nil, err
+	}
+	fs.notifyWritten(username, docID, &dao.Document{Content: doc.Content, Metadata: meta}, false)
+	return &dao.FileSize{Size: meta.Size}, nil
+}
+
+// DeleteFile moves a document to the trash of its owner, or removes it if there is no trash
 func (fs *FileServiceImpl) DeleteFile(username, docID string) error {
-	return fs.fc.DeleteFile(username, docID)
+	unlock := fs.lockDocument(username, docID)
+	defer unlock()
+	if fs.trash == nil {
+		return fs.removeFile(username, docID)
+	}
+	if err := fs.trash.put(username, docID); err != nil {
+		return err
+	}
+	fs.notifyDeleted(username, docID)
+	return nil
+}
+
+// RemoveFile deletes a document for good, without keeping it in the trash
+func (fs *FileServiceImpl) RemoveFile(username, docID string) error {
+	unlock := fs.lockDocument(username, docID)
+	defer unlock()
+	return fs.removeFile(username, docID)
+}
+
+func (fs *FileServiceImpl) removeFile(username, docID string) error {
+	if err := fs.fc.DeleteFile(username, docID); err != nil {
+		return err
+	}
+	if err := fs.ms.Delete(username, docID); err != nil {
+		return err
+	}
+	fs.notifyDeleted(username, docID)
+	return nil
 }
 
+// GetAllUserDocs returns every document of a user, decoding the ones stored encoded or compressed.
+// Documents encrypted with a customer key are returned as stored, as the broker cannot read them.
+// Expired and quarantined documents and the contents kept by the trash are left out.
 func (fs *FileServiceImpl) GetAllUserDocs(username string) (*map[string]string, error) {
-	return fs.fc.GetAllUserDocs(username)
+	docs, err := fs.fc.GetAllUserDocs(username)
+	if err != nil {
+		return nil, err
+	}
+	for docID := range *docs {
+		if strings.HasPrefix(docID, TrashPrefix) {
+			delete(*docs, docID)
+		}
+	}
+	for docID, meta := range fs.ms.List(username) {
+		content, ok := (*docs)[docID]
+		if !ok {
+			continue
+		}
+		if expired(&meta) || (meta.Scan != nil && meta.Scan.Outcome == ScanOutcomeQuarantine) {
+			delete(*docs, docID)
+			continue
+		}
+		if meta.Encryption != nil && meta.Encryption.CustomerKey {
+			continue
+		}
+		raw, err := fs.decodeContent(username, docID, content, meta, nil)
+		if err != nil {
+			return nil, err
+		}
+		(*docs)[docID] = string(raw)
+	}
+	return docs, nil
+}
+
+// GetUserDocSizes returns the size of every document of a user, quarantined ones included, for
+// the callers that need to know which doc IDs are taken or how much is stored rather than the
+// contents. Expired documents and the contents kept by the trash are left out.
+func (fs *FileServiceImpl) GetUserDocSizes(username string) (map[string]int, error) {
+	docs, err := fs.fc.GetAllUserDocs(username)
+	if err != nil {
+		return nil, err
+	}
+	metas := fs.ms.List(username)
+	sizes := make(map[string]int, len(*docs))
+	for docID, content := range *docs {
+		if strings.HasPrefix(docID, TrashPrefix) {
+			continue
+		}
+		meta, ok := metas[docID]
+		if !ok {
+			sizes[docID] = len(content)
+			continue
+		}
+		if !expired(&meta) {
+			sizes[docID] = meta.Size
+		}
+	}
+	return sizes, nil
+}
+
+// ListDocIDs returns the sorted IDs of the documents of a user, as GetAllUserDocs lists them but
+// without decoding any content, so that a document that cannot be read does not fail the
+// listing. Documents stored before the broker kept metadata are listed too.
+func (fs *FileServiceImpl) ListDocIDs(username string) ([]string, error) {
+	docs, err := fs.fc.GetAllUserDocs(username)
+	if err != nil {
+		return nil, err
+	}
+	metas := fs.ms.List(username)
+	docIDs := make([]string, 0, len(*docs))
+	for docID := range *docs {
+		if strings.HasPrefix(docID, TrashPrefix) {
+			continue
+		}
+		if meta, ok := metas[docID]; ok && (expired(&meta) || (meta.Scan != nil && meta.Scan.Outcome == ScanOutcomeQuarantine)) {
+			continue
+		}
+		docIDs = append(docIDs, docID)
+	}
+	sort.Strings(docIDs)
+	return docIDs, nil
+}
+
+// RecordChecksum stores the checksum of the content of a document stored without one, creating
+// the metadata of the documents stored before the broker kept any
+func (fs *FileServiceImpl) RecordChecksum(username, docID string, content []byte) error {
+	unlock := fs.lockDocument(username, docID)
+	defer unlock()
+	meta, ok := fs.ms.Get(username, docID)
+	if !ok {
+		return fs.ms.Put(username, docID, dao.FileMetadata{Size: len(content), SHA256: Checksum(content)})
+	}
+	// The document may have been written again since its content was read
+	if meta.SHA256 != "" {
+		return nil
+	}
+	meta.SHA256 = Checksum(content)
+	return fs.ms.Put(username, docID, *meta)
+}
+
+func (fs *FileServiceImpl) validate(username, docID string, doc *dao.Document) error {
+	for _, v := range fs.validators {
+		if err := v.ValidateFile(username, docID, doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fs *FileServiceImpl) notifyWritten(username, docID string, doc *dao.Document, created bool) {
+	for _, l := range fs.listeners {
+		l.FileWritten(username, docID, doc, created)
+	}
+}
+
+func (fs *FileServiceImpl) notifyDeleted(username, docID string) {
+	for _, l := range fs.listeners {
+		l.FileDeleted(username, docID)
+	}
+}
+
+// expired checks if a document has expired, even if the reaper has not deleted it yet
+func expired(meta *dao.FileMetadata) bool {
+	return meta.ExpiresAt != nil && !time.Now().Before(*meta.ExpiresAt)
+}
+
+// Checksum returns the hex SHA-256 of a content
+func Checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// DocumentChecksum returns the checksum recorded for a document. For documents encrypted with
+// a customer key it is the hex HMAC-SHA256 of the content keyed by that key, as a plain hash
+// would let anyone without the key confirm a guess of the content.
+func DocumentChecksum(doc *dao.Document) string {
+	if doc.CustomerKey == nil {
+		return Checksum(doc.Content)
+	}
+	mac := hmac.New(sha256.New, doc.CustomerKey)
+	mac.Write(doc.Content)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomHex returns size random bytes as hex, for identifiers and secrets
+func randomHex(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newMetadata builds the metadata of a document about to be written
+func newMetadata(doc *dao.Document) dao.FileMetadata {
+	now := time.Now().UTC()
+	meta := doc.Metadata
+	meta.Size = len(doc.Content)
+	meta.SHA256 = DocumentChecksum(doc)
+	meta.CreatedAt = now
+	meta.UpdatedAt = now
+	return meta
+}
+
+// encodeContent turns a document into what is sent to the file service and records in the
+// metadata how to read it back: compressed if that makes it smaller, encrypted if enabled, then
+// base64 encoded if needed, as the file service keeps contents as JSON strings that would mangle invalid UTF-8
+func (fs *FileServiceImpl) encodeContent(username, docID string, doc *dao.Document, meta *dao.FileMetadata) ([]byte, error) {
+	content := doc.Content
+	meta.Compression = ""
+	meta.Encryption = nil
+	meta.Encoding = ""
+	if fs.compression != "" && len(content) >= fs.compressionMinSize {
+		compressed, err := common.Compress(fs.compression, content)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed) < len(content) {
+			content = compressed
+			meta.Compression = fs.compression
+		}
+	}
+	if doc.CustomerKey != nil {
+		sealed, err := kms.Seal(doc.CustomerKey, content, documentAAD(username, docID))
+		if err != nil {
+			return nil, err
+		}
+		content = sealed
+		meta.Encryption = &dao.EncryptionInfo{Algorithm: EncryptionAES256GCM, CustomerKey: true}
+	} else if fs.kms != nil {
+		encrypted, info, err := fs.encrypt(username, docID, content)
+		if err != nil {
+			return nil, err
+		}
+		content = encrypted
+		meta.Encryption = info
+	}
+	if utf8.Valid(content) {
+		return content, nil
+	}
+	meta.Encoding = EncodingBase64
+	encoded := make([]byte, base64.StdEncoding.EncodedLen(len(content)))
+	base64.StdEncoding.Encode(encoded, content)
+	return encoded, nil
+}
+
+// decodeContent reverts encodeContent
+func (fs *FileServiceImpl) decodeContent(username, docID, content string, meta dao.FileMetadata, customerKey []byte) ([]byte, error) {
+	raw := []byte(content)
+	if meta.Encoding == EncodingBase64 {
+		var err error
+		if raw, err = base64.StdEncoding.DecodeString(content); err != nil {
+			return nil, err
+		}
+	}
+	if meta.Encryption != nil && meta.Encryption.CustomerKey {
+		if customerKey == nil {
+			return nil, common.CustomerKeyRequiredError()
+		}
+		var err error
+		// Authentication fails with any other key
+		if raw, err = kms.Open(customerKey, raw, documentAAD(username, docID)); err != nil {
+			return nil, common.CustomerKeyMismatchError()
+		}
+	} else if meta.Encryption != nil {
+		var err error
+		if raw, err = fs.decrypt(username, docID, raw, meta.Encryption); err != nil {
+			return nil, err
+		}
+	}
+	if meta.Compression == "" {
+		return raw, nil
+	}
+	return common.Decompress(meta.Compression, bytes.NewReader(raw), -1)
+}
+
+// encrypt seals content with a new data key, bound to the document so that stored contents
+// cannot be swapped between documents or users
+func (fs *FileServiceImpl) encrypt(username, docID string, content []byte) ([]byte, *dao.EncryptionInfo, error) {
+	dataKey, err := kms.NewDataKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	wrapped, keyID, err := fs.kms.WrapKey(username, dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed, err := kms.Seal(dataKey, content, documentAAD(username, docID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return sealed, &dao.EncryptionInfo{Algorithm: EncryptionAES256GCM, KeyID: keyID, WrappedKey: wrapped}, nil
+}
+
+func (fs *FileServiceImpl) decrypt(username, docID string, sealed []byte, info *dao.EncryptionInfo) ([]byte, error) {
+	if fs.kms == nil {
+		return nil, errors.New("document " + docID + " is encrypted but encryption is not enabled")
+	}
+	if info.Algorithm != EncryptionAES256GCM {
+		return nil, errors.New("unsupported encryption algorithm " + info.Algorithm)
+	}
+	dataKey, err := fs.kms.UnwrapKey(username, info.KeyID, info.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	return kms.Open(dataKey, sealed, documentAAD(username, docID))
+}
+
+func documentAAD(username, docID string) []byte {
+	return []byte(username + "/" + docID)
+}
+
+// RewrapKeys wraps again with the current master key every data key wrapped with an older one.
+// Only the metadata changes, the stored contents stay encrypted with the same data keys.
+func (fs *FileServiceImpl) RewrapKeys() error {
+	if fs.kms == nil {
+		return nil
+	}
+	current := fs.kms.CurrentKeyID()
+	rewrapped := 0
+	for _, username := range fs.ms.Usernames() {
+		for docID, meta := range fs.ms.List(username) {
+			if meta.Encryption == nil || meta.Encryption.CustomerKey || meta.Encryption.KeyID == current {
+				continue
+			}
+			dataKey, err := fs.kms.UnwrapKey(username, meta.Encryption.KeyID, meta.Encryption.WrappedKey)
+			if err != nil {
+				log.Errorf("Error unwrapping the data key of %s/%s: %v", username, docID, err)
+				continue
+			}
+			wrapped, keyID, err := fs.kms.WrapKey(username, dataKey)
+			if err != nil {
+				return err
+			}
+			old := meta.Encryption.WrappedKey
+			err = fs.ms.Update(username, docID, func(m *dao.FileMetadata) bool {
+				// The document may have been written again in the meantime, with another data key
+				if m.Encryption == nil || !bytes.Equal(m.Encryption.WrappedKey, old) {
+					return false
+				}
+				m.Encryption = &dao.EncryptionInfo{Algorithm: m.Encryption.Algorithm, KeyID: keyID, WrappedKey: wrapped}
+				rewrapped++
+				return true
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if rewrapped > 0 {
+		log.Infof("Rewrapped %d data keys with master key %s", rewrapped, current)
+	}
+	return nil
+}
+
+// rewrapEvery reloads the master keys and rewraps the data keys periodically, so that
+// rotating the master key from outside the broker eventually retires the old one
+func (fs *FileServiceImpl) rewrapEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		if r, ok := fs.kms.(kms.Reloader); ok {
+			if err := r.Reload(); err != nil {
+				log.Error("Error reloading master keys: ", err)
+				continue
+			}
+		}
+		if err := fs.RewrapKeys(); err != nil {
+			log.Error("Error rewrapping data keys: ", err)
+		}
+	}
 }
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"path/filepath"
+	"seg-red-broker/internal/app/client"
+	"seg-red-broker/internal/app/client/clienttest"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/kms"
+	"seg-red-broker/internal/app/store"
+	"strings"
+	"testing"
+)
+
+// newTestFileService creates a FileService backed by a fake file service, keeping its local
+// state in a temporary data folder
+func newTestFileService(t *testing.T) (*FileServiceImpl, *clienttest.FileService) {
+	t.Helper()
+	backend := clienttest.StartFileService(t)
+	t.Setenv("DATA_FOLDER", t.TempDir())
+	t.Setenv("STORAGE_COMPRESSION", "")
+	return NewFileService(*client.NewFileClient(), store.NewMetadataStore()), backend
+}
+
+func TestGetAllUserDocsSkipsQuarantined(t *testing.T) {
+	fs, _ := newTestFileService(t)
+	scan := &ScanServiceImpl{policies: map[string]string{ScanCategorySecret: ScanOutcomeQuarantine}}
+	scan.AddScanner(&fakeScanner{category: ScanCategorySecret, match: "password"})
+	fs.AddValidator(scan)
+
+	if _, err := fs.CreateFile("ana", "clean", &dao.Document{Content: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.CreateFile("ana", "leak", &dao.Document{Content: []byte("password=hunter2")}); err != nil {
+		t.Fatal(err)
+	}
+
+	docs, err := fs.GetAllUserDocs("ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := (*docs)["leak"]; ok || (*docs)["clean"] != "hello" {
+		t.Errorf("GetAllUserDocs = %v, want only the clean document", *docs)
+	}
+	sizes, err := fs.GetUserDocSizes("ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sizes["leak"] != len("password=hunter2") {
+		t.Errorf("GetUserDocSizes = %v, want the quarantined document too", sizes)
+	}
+}
+
+func TestUpdateFileIfMatch(t *testing.T) {
+	fs, _ := newTestFileService(t)
+	if _, err := fs.CreateFile("ana", "doc", &dao.Document{Content: []byte("v1")}); err != nil {
+		t.Fatal(err)
+	}
+	v1, err := fs.GetFile("ana", "doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.UpdateFile("ana", "doc", &dao.Document{Content: []byte("v2"), IfMatch: ETag(v1)}); err != nil {
+		t.Fatalf("update matching the current ETag: %v", err)
+	}
+	_, err = fs.UpdateFile("ana", "doc", &dao.Document{Content: []byte("v3"), IfMatch: ETag(v1)})
+	if !isPreconditionFailed(err) {
+		t.Fatalf("update with a stale ETag: %v, want a failed precondition", err)
+	}
+	if doc, _ := fs.GetFile("ana", "doc"); string(doc.Content) != "v2" {
+		t.Fatalf("content %q after a failed precondition, want v2", doc.Content)
+	}
+}
+
+func TestEnvelopeEncryption(t *testing.T) {
+	fs, backend := newTestFileService(t)
+	local, err := kms.NewLocalKMS(filepath.Join(t.TempDir(), "master.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.kms = local
+	plaintext := "attack at dawn"
+	if _, err := fs.CreateFile("ana", "secret", &dao.Document{Content: []byte(plaintext)}); err != nil {
+		t.Fatal(err)
+	}
+	// Stored before encryption was enabled
+	backend.Put("ana", "legacy", "plain old content")
+
+	stored, _ := backend.Stored("ana", "secret")
+	if strings.Contains(stored, plaintext) {
+		t.Fatalf("the file service got the plaintext %q", stored)
+	}
+	meta, _ := fs.ms.Get("ana", "secret")
+	if meta.Encryption == nil || meta.Encryption.KeyID != local.CurrentKeyID() || len(meta.Encryption.WrappedKey) == 0 {
+		t.Fatalf("encryption metadata %+v, want a data key wrapped with the current master key", meta.Encryption)
+	}
+	for docID, want := range map[string]string{"secret": plaintext, "legacy": "plain old content"} {
+		if doc, err := fs.GetFile("ana", docID); err != nil || string(doc.Content) != want {
+			t.Fatalf("%s read back as %v (%v), want %q", docID, doc, err, want)
+		}
+	}
+
+	// The ciphertext is bound to its doc ID, it cannot be read under another one
+	backend.Put("ana", "moved", stored)
+	if err := fs.ms.Put("ana", "moved", *meta); err != nil {
+		t.Fatal(err)
+	}
+	if doc, err := fs.GetFile("ana", "moved"); err == nil {
+		t.Fatalf("a ciphertext copied under another doc ID was read as %q", doc.Content)
+	}
+
+	// After a rotation the data keys are wrapped again and the old master key can be retired
+	old := local.CurrentKeyID()
+	if _, err := local.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RewrapKeys(); err != nil {
+		t.Fatal(err)
+	}
+	meta, _ = fs.ms.Get("ana", "secret")
+	if meta.Encryption.KeyID != local.CurrentKeyID() {
+		t.Fatalf("data key wrapped with %s after the rotation, want %s", meta.Encryption.KeyID, local.CurrentKeyID())
+	}
+	if after, _ := backend.Stored("ana", "secret"); after != stored {
+		t.Fatal("rewrapping the data key rewrote the content")
+	}
+	if err := local.Retire(old); err != nil {
+		t.Fatal(err)
+	}
+	if doc, err := fs.GetFile("ana", "secret"); err != nil || string(doc.Content) != plaintext {
+		t.Fatalf("secret read back as %v (%v) after retiring the old master key", doc, err)
+	}
+}
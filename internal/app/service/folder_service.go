@@ -0,0 +1,127 @@
+package service
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/client"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"sort"
+	"strings"
+)
+
+// PathSeparator separates the segments of nested doc IDs such as projects/2024/report.md
+const PathSeparator = "/"
+
+// NormalizeDocID cleans a doc ID, which may be a nested path: empty and "." segments are
+// dropped and ".." is rejected. Nested segments cannot start with an underscore, as those
+// name the broker endpoints and document actions, and the doc IDs the trash and nested doc IDs
+// are stored under are reserved.
+func NormalizeDocID(docID string) (string, *common.APIError) {
+	var segments []string
+	for _, segment := range strings.Split(docID, PathSeparator) {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			return "", common.BadRequestError("parent directory references are not allowed")
+		}
+		segments = append(segments, segment)
+	}
+	if len(segments) == 0 {
+		return "", common.EmptyParamsError("doc_id")
+	}
+	for _, reserved := range []string{TrashPrefix, client.NestedDocPrefix} {
+		if strings.HasPrefix(segments[0], reserved) {
+			return "", common.BadRequestError("doc IDs starting with " + reserved + " are reserved")
+		}
+	}
+	if len(segments) > 1 {
+		for _, segment := range segments {
+			if strings.HasPrefix(segment, "_") {
+				return "", common.BadRequestError("path segments starting with _ are reserved")
+			}
+		}
+	}
+	return strings.Join(segments, PathSeparator), nil
+}
+
+type FolderServiceImpl struct {
+	fs FileService
+}
+
+func NewFolderService(fs FileService) *FolderServiceImpl {
+	return &FolderServiceImpl{fs: fs}
+}
+
+type FolderService interface {
+	List(username, prefix, delimiter string) (*dao.FolderListing, error)
+	DeleteFolder(username, folder string) (*dao.FolderDeletion, error)
+}
+
+// List returns the doc IDs starting with prefix. With a delimiter, the doc IDs that contain
+// it after the prefix are rolled up into the folders they belong to, so that only the
+// immediate children of a folder are listed.
+func (svc *FolderServiceImpl) List(username, prefix, delimiter string) (*dao.FolderListing, error) {
+	docIDs, err := svc.fs.ListDocIDs(username)
+	if err != nil {
+		return nil, err
+	}
+	listing := &dao.FolderListing{
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		Documents: make([]string, 0),
+		Folders:   make([]string, 0),
+	}
+	folders := make(map[string]bool)
+	for _, docID := range docIDs {
+		rest, ok := strings.CutPrefix(docID, prefix)
+		if !ok {
+			continue
+		}
+		if delimiter != "" {
+			if i := strings.Index(rest, delimiter); i >= 0 {
+				folders[prefix+rest[:i+len(delimiter)]] = true
+				continue
+			}
+		}
+		listing.Documents = append(listing.Documents, docID)
+	}
+	for folder := range folders {
+		listing.Folders = append(listing.Folders, folder)
+	}
+	sort.Strings(listing.Folders)
+	return listing, nil
+}
+
+// DeleteFolder deletes every document under a folder, at any depth. The documents are
+// deleted one by one and the ones that fail are reported, the others stay deleted.
+func (svc *FolderServiceImpl) DeleteFolder(username, folder string) (*dao.FolderDeletion, error) {
+	// Quarantined documents are deleted along, even though they are not listed
+	docs, err := svc.fs.GetUserDocSizes(username)
+	if err != nil {
+		return nil, err
+	}
+	prefix := folder + PathSeparator
+	var docIDs []string
+	for docID := range docs {
+		if strings.HasPrefix(docID, prefix) {
+			docIDs = append(docIDs, docID)
+		}
+	}
+	if len(docIDs) == 0 {
+		return nil, common.NotFoundError("folder " + folder + " not found")
+	}
+	sort.Strings(docIDs)
+
+	deletion := &dao.FolderDeletion{Folder: folder, Deleted: make([]string, 0), Failed: make([]dao.FileResult, 0)}
+	for _, docID := range docIDs {
+		err := svc.fs.DeleteFile(username, docID)
+		// Documents deleted in the meantime are gone as requested
+		if err != nil && common.ToAPIError(err).StatusCode != http.StatusNotFound {
+			deletion.Failed = append(deletion.Failed, dao.FileResult{DocID: docID, Error: common.PublicError(err)})
+			continue
+		}
+		deletion.Deleted = append(deletion.Deleted, docID)
+	}
+	return deletion, nil
+}
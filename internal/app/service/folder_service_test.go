@@ -0,0 +1,84 @@
+package service
+
+import (
+	"reflect"
+	"seg-red-broker/internal/app/client"
+	"seg-red-broker/internal/app/dao"
+	"testing"
+)
+
+func TestNestedDocIDRoundTrip(t *testing.T) {
+	fs, backend := newTestFileService(t)
+	docID := "projects/2024/report.md"
+	if _, err := fs.CreateFile("ana", docID, &dao.Document{Content: []byte("quarterly")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := backend.Stored("ana", client.NestedDocPrefix+"projects~12024~1report.md"); !ok {
+		t.Fatal("the nested document is not stored under a single path segment")
+	}
+	doc, err := fs.GetFile("ana", docID)
+	if err != nil || string(doc.Content) != "quarterly" {
+		t.Fatalf("GetFile = %v, %v, want the nested document", doc, err)
+	}
+	docs, err := fs.GetAllUserDocs("ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (*docs)[docID] != "quarterly" {
+		t.Fatalf("GetAllUserDocs = %v, want the nested doc ID", *docs)
+	}
+	listing, err := NewFolderService(fs).List("ana", "projects/", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(listing.Folders, []string{"projects/2024/"}) || len(listing.Documents) != 0 {
+		t.Fatalf("listing %+v, want the folder projects/2024/", listing)
+	}
+
+	if err := fs.DeleteFile("ana", docID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.GetFile("ana", docID); err == nil {
+		t.Fatal("the nested document is still readable once deleted")
+	}
+	if docIDs, _ := fs.ListDocIDs("ana"); len(docIDs) != 0 {
+		t.Fatalf("ListDocIDs = %v once deleted, want none", docIDs)
+	}
+}
+
+func TestFolderListSkipsUnreadableContents(t *testing.T) {
+	fs, _ := newTestFileService(t)
+	for _, docID := range []string{"notes/a", "notes/b"} {
+		if _, err := fs.CreateFile("ana", docID, &dao.Document{Content: []byte("text")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The stored content no longer decodes as the metadata says
+	err := fs.ms.Update("ana", "notes/b", func(meta *dao.FileMetadata) bool {
+		meta.Compression = "gzip"
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.GetAllUserDocs("ana"); err == nil {
+		t.Fatal("GetAllUserDocs decoded a tampered document")
+	}
+
+	listing, err := NewFolderService(fs).List("ana", "notes/", "")
+	if err != nil {
+		t.Fatalf("listing with a document that cannot be decoded: %v", err)
+	}
+	if !reflect.DeepEqual(listing.Documents, []string{"notes/a", "notes/b"}) {
+		t.Fatalf("listing %+v, want both documents", listing)
+	}
+}
+
+func TestNormalizeDocIDReservesNestedStorage(t *testing.T) {
+	if _, err := NormalizeDocID(client.NestedDocPrefix + "a~1b"); err == nil {
+		t.Fatal("a doc ID nested documents are stored under was accepted")
+	}
+	if docID, err := NormalizeDocID("/projects//./2024/report.md"); err != nil || docID != "projects/2024/report.md" {
+		t.Fatalf("NormalizeDocID = %q, %v", docID, err)
+	}
+}
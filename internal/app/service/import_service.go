@@ -0,0 +1,261 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"strconv"
+	"strings"
+)
+
+// Conflict policies for documents written to a doc ID that already exists.
+// Imports can skip them, moves and copies can fail instead.
+const (
+	ConflictFail      = "fail"
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictRename    = "rename"
+)
+
+// Actions taken for imported documents
+const (
+	ImportCreated     = "created"
+	ImportOverwritten = "overwritten"
+	ImportRenamed     = "renamed"
+)
+
+type ImportServiceImpl struct {
+	fs           FileService
+	maxEntries   int64
+	maxEntrySize int64
+	maxTotalSize int64
+}
+
+func NewImportService(fs FileService) *ImportServiceImpl {
+	return &ImportServiceImpl{
+		fs:           fs,
+		maxEntries:   common.GetEnvInt64("IMPORT_MAX_ENTRIES", 10000),
+		maxEntrySize: common.GetEnvInt64("IMPORT_MAX_ENTRY_SIZE", 32<<20),
+		maxTotalSize: common.GetEnvInt64("IMPORT_MAX_TOTAL_SIZE", 1<<30),
+	}
+}
+
+type ImportService interface {
+	Import(username string, archive io.ReaderAt, size int64, policy string, dryRun bool) (*dao.ImportReport, error)
+}
+
+// scannedEntry is a non directory entry found while scanning an archive
+type scannedEntry struct {
+	path     string
+	size     int
+	manifest bool
+	err      *common.APIError
+}
+
+// Import creates a document for every regular file of a zip or tar.gz archive.
+// The archive is first scanned entirely, so that oversized or malicious archives are
+// rejected before anything is written, and then read again to create the documents.
+func (svc *ImportServiceImpl) Import(username string, archive io.ReaderAt, size int64, policy string, dryRun bool) (*dao.ImportReport, error) {
+	switch policy {
+	case ConflictSkip, ConflictOverwrite, ConflictRename:
+	default:
+		return nil, common.BadRequestError("conflict must be skip, overwrite or rename")
+	}
+	format, ok := detectArchive(archive)
+	if !ok {
+		return nil, common.UnsupportedMediaTypeError("archive must be a zip or a tar.gz file")
+	}
+
+	scanned, contentTypes, err := svc.scan(format, archive, size)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := svc.fs.GetUserDocSizes(username)
+	if err != nil {
+		return nil, err
+	}
+	plan := planImport(scanned, existing, policy)
+
+	report := &dao.ImportReport{
+		DryRun:   dryRun,
+		Imported: make([]dao.ImportEntry, 0),
+		Skipped:  make([]dao.ImportEntry, 0),
+		Failed:   make([]dao.ImportEntry, 0),
+	}
+	if !dryRun {
+		if err := svc.write(username, format, archive, size, plan, contentTypes); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range plan {
+		switch {
+		case entry == nil:
+		case entry.Error != nil:
+			report.Failed = append(report.Failed, *entry)
+		case entry.Action == "":
+			report.Skipped = append(report.Skipped, *entry)
+		default:
+			report.Imported = append(report.Imported, *entry)
+		}
+	}
+	return report, nil
+}
+
+// scan reads the whole archive enforcing the entry count and size limits, and collects the
+// content types listed in the manifest of archives produced by an export
+func (svc *ImportServiceImpl) scan(format string, archive io.ReaderAt, size int64) ([]scannedEntry, map[string]string, error) {
+	var scanned []scannedEntry
+	var total int64
+	contentTypes := make(map[string]string)
+	err := walkArchive(format, archive, size, func(name string, isDir, isRegular bool, r io.Reader) error {
+		if isDir {
+			return nil
+		}
+		if int64(len(scanned)) >= svc.maxEntries {
+			return common.PayloadTooLargeError("archive has too many entries")
+		}
+		if !isRegular {
+			scanned = append(scanned, scannedEntry{path: name, err: common.BadRequestError("unsupported entry type")})
+			return nil
+		}
+
+		// Never trust the sizes declared by the archive, count the bytes actually decompressed
+		var manifest bytes.Buffer
+		w := io.Discard
+		if name == ExportManifestName {
+			w = &manifest
+		}
+		n, err := io.Copy(w, io.LimitReader(r, svc.maxEntrySize+1))
+		if err != nil {
+			return common.BadRequestError("corrupted archive")
+		}
+		if n > svc.maxEntrySize {
+			return common.PayloadTooLargeError("archive entry " + name + " exceeds the maximum entry size")
+		}
+		total += n
+		if total > svc.maxTotalSize {
+			return common.PayloadTooLargeError("archive expands beyond the maximum import size")
+		}
+
+		entry := scannedEntry{path: name, size: int(n), manifest: name == ExportManifestName}
+		if entry.manifest {
+			var m dao.ExportManifest
+			if json.Unmarshal(manifest.Bytes(), &m) == nil {
+				for _, doc := range m.Documents {
+					contentTypes[doc.Path] = doc.ContentType
+				}
+			}
+		}
+		scanned = append(scanned, entry)
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(*common.APIError); ok {
+			return nil, nil, err
+		}
+		return nil, nil, common.BadRequestError("corrupted archive")
+	}
+	return scanned, contentTypes, nil
+}
+
+// planImport decides what to do with every scanned entry. The manifest gets a nil plan.
+func planImport(scanned []scannedEntry, existing map[string]int, policy string) []*dao.ImportEntry {
+	taken := make(map[string]bool, len(existing))
+	for docID := range existing {
+		taken[docID] = true
+	}
+
+	plan := make([]*dao.ImportEntry, len(scanned))
+	for i, s := range scanned {
+		if s.manifest {
+			continue
+		}
+		entry := &dao.ImportEntry{Path: s.path, Size: s.size, Error: s.err}
+		plan[i] = entry
+		if entry.Error != nil {
+			continue
+		}
+		docID, apiErr := importDocID(s.path)
+		if apiErr != nil {
+			entry.Error = apiErr
+			continue
+		}
+
+		entry.DocID = docID
+		entry.Action = ImportCreated
+		if taken[docID] {
+			switch policy {
+			case ConflictSkip:
+				entry.Action = ""
+				entry.Reason = "document already exists"
+			case ConflictOverwrite:
+				entry.Action = ImportOverwritten
+			case ConflictRename:
+				entry.DocID = renameDocID(docID, taken)
+				entry.Action = ImportRenamed
+			}
+		}
+		taken[entry.DocID] = true
+	}
+	return plan
+}
+
+// write reads the archive again and stores the entries planned for import
+func (svc *ImportServiceImpl) write(username, format string, archive io.ReaderAt, size int64, plan []*dao.ImportEntry, contentTypes map[string]string) error {
+	i := 0
+	return walkArchive(format, archive, size, func(name string, isDir, isRegular bool, r io.Reader) error {
+		if isDir {
+			return nil
+		}
+		entry := plan[i]
+		i++
+		if entry == nil || entry.Error != nil || entry.Action == "" {
+			return nil
+		}
+
+		content, err := io.ReadAll(io.LimitReader(r, svc.maxEntrySize))
+		if err != nil {
+			return err
+		}
+		doc := &dao.Document{Content: content, Metadata: dao.FileMetadata{ContentType: contentTypes[name]}}
+		if entry.Action == ImportOverwritten {
+			_, err = svc.fs.UpdateFile(username, entry.DocID, doc)
+		} else {
+			_, err = svc.fs.CreateFile(username, entry.DocID, doc)
+		}
+		if err != nil {
+			entry.Error = common.PublicError(err)
+		}
+		return nil
+	})
+}
+
+// importDocID turns an archive path into a doc ID, rejecting paths that could escape the
+// user's documents (zip-slip). Entries of an export are found under the documents folder.
+func importDocID(name string) (string, *common.APIError) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if path.IsAbs(name) {
+		return "", common.BadRequestError("absolute paths are not allowed")
+	}
+	// Rejecting ".." before cleaning the path keeps "a/../b" from being read as "b"
+	docID, apiErr := NormalizeDocID(name)
+	if apiErr != nil {
+		return "", apiErr
+	}
+	return NormalizeDocID(strings.TrimPrefix(docID, ExportDocumentsDir))
+}
+
+// renameDocID finds a free doc ID by adding a counter before the extension
+func renameDocID(docID string, taken map[string]bool) string {
+	ext := path.Ext(docID)
+	base := strings.TrimSuffix(docID, ext)
+	for n := 1; ; n++ {
+		candidate := base + "-" + strconv.Itoa(n) + ext
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
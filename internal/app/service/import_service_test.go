@@ -0,0 +1,164 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"testing"
+)
+
+// zipArchive builds a zip archive out of name and content pairs
+func zipArchive(t *testing.T, entries ...string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := 0; i+1 < len(entries); i += 2 {
+		w, err := zw.Create(entries[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(entries[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func importedDocIDs(entries []dao.ImportEntry) map[string]string {
+	docIDs := make(map[string]string)
+	for _, entry := range entries {
+		docIDs[entry.Path] = entry.DocID
+	}
+	return docIDs
+}
+
+func TestImportRejectsEscapingPaths(t *testing.T) {
+	fs, backend := newTestFileService(t)
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, header := range []*tar.Header{
+		{Name: "../evil", Typeflag: tar.TypeReg, Size: 1},
+		{Name: "/etc/cron.d/evil", Typeflag: tar.TypeReg, Size: 1},
+		{Name: "notes/../../evil", Typeflag: tar.TypeReg, Size: 1},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		{Name: "notes/", Typeflag: tar.TypeDir},
+		{Name: "notes/ok", Typeflag: tar.TypeReg, Size: 1},
+	} {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := tw.Write([]byte("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := NewImportService(fs).Import("ana", bytes.NewReader(buf.Bytes()), int64(buf.Len()), ConflictSkip, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported := importedDocIDs(report.Imported); len(imported) != 1 || imported["notes/ok"] != "notes/ok" {
+		t.Fatalf("imported %v, want only notes/ok", imported)
+	}
+	failed := importedDocIDs(report.Failed)
+	for _, name := range []string{"../evil", "/etc/cron.d/evil", "notes/../../evil", "link"} {
+		if docID, ok := failed[name]; !ok || docID != "" {
+			t.Errorf("%s was not rejected, failed entries %v", name, failed)
+		}
+	}
+	docs, err := fs.ListDocIDs("ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 {
+		t.Fatalf("documents %v after the import, want only notes/ok", docs)
+	}
+	if _, ok := backend.Stored("ana", "evil"); ok {
+		t.Fatal("an escaping path was imported")
+	}
+}
+
+func TestImportRejectsDecompressionBombs(t *testing.T) {
+	fs, _ := newTestFileService(t)
+	t.Setenv("IMPORT_MAX_ENTRY_SIZE", "1024")
+	t.Setenv("IMPORT_MAX_TOTAL_SIZE", "2048")
+	svc := NewImportService(fs)
+	zeros := string(make([]byte, 1<<20))
+	kilo := string(make([]byte, 1000))
+
+	for name, archive := range map[string]*bytes.Reader{
+		"entry over the limit": zipArchive(t, "small", "x", "bomb", zeros),
+		"total over the limit": zipArchive(t, "a", kilo, "b", kilo, "c", kilo),
+	} {
+		_, err := svc.Import("ana", archive, archive.Size(), ConflictSkip, false)
+		if err == nil || common.ToAPIError(err).StatusCode != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: import returned %v, want 413", name, err)
+		}
+	}
+	// Archives are rejected before anything is written
+	if docs, err := fs.ListDocIDs("ana"); err != nil || len(docs) != 0 {
+		t.Fatalf("documents %v (%v) after rejected imports, want none", docs, err)
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	fs, backend := newTestFileService(t)
+	svc := NewImportService(fs)
+	if _, err := fs.CreateFile("ana", "a.txt", &dao.Document{Content: []byte("old")}); err != nil {
+		t.Fatal(err)
+	}
+	archive := zipArchive(t, "a.txt", "new", "b.txt", "b")
+
+	report, err := svc.Import("ana", archive, archive.Size(), ConflictRename, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported := importedDocIDs(report.Imported); !report.DryRun || imported["a.txt"] != "a-1.txt" {
+		t.Fatalf("dry run planned %v, want a.txt renamed", imported)
+	}
+	if _, ok := backend.Stored("ana", "b.txt"); ok {
+		t.Fatal("a dry run wrote documents")
+	}
+
+	report, err = svc.Import("ana", archive, archive.Size(), ConflictSkip, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0].Path != "a.txt" || len(report.Imported) != 1 {
+		t.Fatalf("skip policy imported %+v and skipped %+v", report.Imported, report.Skipped)
+	}
+
+	report, err = svc.Import("ana", archive, archive.Size(), ConflictOverwrite, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Imported) != 2 || report.Imported[0].Action != ImportOverwritten {
+		t.Fatalf("overwrite policy imported %+v", report.Imported)
+	}
+	if doc, err := fs.GetFile("ana", "a.txt"); err != nil || string(doc.Content) != "new" {
+		t.Fatalf("a.txt is %v (%v) after overwriting it", doc, err)
+	}
+
+	report, err = svc.Import("ana", archive, archive.Size(), ConflictRename, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported := importedDocIDs(report.Imported); imported["a.txt"] != "a-1.txt" || imported["b.txt"] != "b-1.txt" {
+		t.Fatalf("rename policy imported %v", imported)
+	}
+}
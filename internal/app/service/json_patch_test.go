@@ -0,0 +1,132 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"testing"
+)
+
+func mustDecodeJSON(t *testing.T, data string) interface{} {
+	t.Helper()
+	v, err := decodeJSON([]byte(data))
+	if err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+	return v
+}
+
+// The examples of RFC 6902 Appendix A, and the pointer, index and number rules they rely on.
+// A result of "" expects the patch to fail with status.
+var jsonPatchTests = []struct {
+	name   string
+	doc    string
+	patch  string
+	result string
+	status int
+}{
+	{"A.1 add an object member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, 0},
+	{"A.2 add an array element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, 0},
+	{"A.3 remove an object member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`, 0},
+	{"A.4 remove an array element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, 0},
+	{"A.5 replace a value", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, 0},
+	{"A.6 move a value", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+		`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, 0},
+	{"A.7 move an array element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`, 0},
+	{"A.8 test a value, success", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+		`{"baz":"qux","foo":["a",2,"c"]}`, 0},
+	{"A.9 test a value, error", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", http.StatusConflict},
+	{"A.10 add a nested member object", `{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"child":{"grandchild":{}},"foo":"bar"}`, 0},
+	{"A.11 ignore unrecognized elements", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux","xyz":123}]`, `{"baz":"qux","foo":"bar"}`, 0},
+	{"A.12 add to a nonexistent target", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", http.StatusConflict},
+	{"A.14 ~ escape ordering", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`, 0},
+	{"A.15 compare strings and numbers", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":"10"}]`, "", http.StatusConflict},
+	{"A.16 add an array value", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`, 0},
+
+	{"escaped slash", `{"a/b":1}`, `[{"op":"replace","path":"/a~1b","value":2}]`, `{"a/b":2}`, 0},
+	{"replace the whole document", `{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`, 0},
+	{"remove the whole document", `{"a":1}`, `[{"op":"remove","path":""}]`, "", http.StatusConflict},
+	{"- only appends", `{"foo":["bar"]}`, `[{"op":"remove","path":"/foo/-"}]`, "", http.StatusConflict},
+	{"index with a leading zero", `{"foo":["a","b"]}`, `[{"op":"remove","path":"/foo/01"}]`, "", http.StatusConflict},
+	{"index past the end", `{"foo":["a"]}`, `[{"op":"add","path":"/foo/2","value":"c"}]`, "", http.StatusConflict},
+	{"add at the end index", `{"foo":["a"]}`, `[{"op":"add","path":"/foo/1","value":"b"}]`, `{"foo":["a","b"]}`, 0},
+	{"replace a missing member", `{"a":1}`, `[{"op":"replace","path":"/b","value":2}]`, "", http.StatusConflict},
+	{"move into a child", `{"a":{"b":{}}}`, `[{"op":"move","from":"/a","path":"/a/b/c"}]`, "", http.StatusConflict},
+	{"move to a sibling sharing a prefix", `{"a":1}`, `[{"op":"move","from":"/a","path":"/ab"}]`, `{"ab":1}`, 0},
+	{"copy is deep", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, `{"a":{"b":1},"c":{"b":2}}`, 0},
+	{"numbers compare by value", `{"n":1.0}`, `[{"op":"test","path":"/n","value":1}]`, `{"n":1.0}`, 0},
+	{"object members compare unordered", `{"o":{"a":1,"b":[1,2]}}`, `[{"op":"test","path":"/o","value":{"b":[1,2],"a":1}}]`, `{"o":{"a":1,"b":[1,2]}}`, 0},
+	{"a failed operation fails the whole patch", `{"a":1}`, `[{"op":"add","path":"/b","value":2},{"op":"test","path":"/a","value":2}]`, "", http.StatusConflict},
+	{"missing path", `{}`, `[{"op":"add","value":1}]`, "", http.StatusBadRequest},
+	{"missing value", `{}`, `[{"op":"add","path":"/a"}]`, "", http.StatusBadRequest},
+	{"missing from", `{"a":1}`, `[{"op":"copy","path":"/b"}]`, "", http.StatusBadRequest},
+	{"pointer without a slash", `{"a":1}`, `[{"op":"remove","path":"a"}]`, "", http.StatusBadRequest},
+	{"unknown operation", `{}`, `[{"op":"merge","path":"/a","value":1}]`, "", http.StatusBadRequest},
+}
+
+func TestJSONPatch(t *testing.T) {
+	for _, test := range jsonPatchTests {
+		t.Run(test.name, func(t *testing.T) {
+			var ops []jsonPatchOp
+			if err := json.Unmarshal([]byte(test.patch), &ops); err != nil {
+				t.Fatal(err)
+			}
+			got, err := jsonPatch(mustDecodeJSON(t, test.doc), ops)
+			if test.result == "" {
+				if err == nil {
+					t.Fatalf("patch succeeded with %v, want status %d", got, test.status)
+				}
+				if status := common.ToAPIError(err).StatusCode; status != test.status {
+					t.Fatalf("status %d (%v), want %d", status, err, test.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := mustDecodeJSON(t, test.result); !jsonEqual(got, want) {
+				t.Fatalf("patched %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestJSONPatchKeepsNumbersAsWritten(t *testing.T) {
+	var ops []jsonPatchOp
+	if err := json.Unmarshal([]byte(`[{"op":"add","path":"/x","value":1e2}]`), &ops); err != nil {
+		t.Fatal(err)
+	}
+	got, err := jsonPatch(mustDecodeJSON(t, `{"big":12345678901234567890,"d":0.10}`), ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded, _ := encodeJSON(got); string(encoded) != `{"big":12345678901234567890,"d":0.10,"x":1e2}` {
+		t.Fatalf("encoded %s, want the numbers as written", encoded)
+	}
+}
+
+// The examples of RFC 7396 Appendix A
+func TestMergePatch(t *testing.T) {
+	for _, test := range []struct{ target, patch, result string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	} {
+		got := mergePatch(mustDecodeJSON(t, test.target), mustDecodeJSON(t, test.patch))
+		if want := mustDecodeJSON(t, test.result); !jsonEqual(got, want) {
+			t.Errorf("merging %s into %s = %v, want %s", test.patch, test.target, got, test.result)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package service
+
+import "sync"
+
+// keyLock serialises operations by key, like the operations on a document or an upload.
+// A key only holds a mutex while it is locked or waited for, so keys that are done with do
+// not pile up for the life of the process.
+type keyLock struct {
+	mu    sync.Mutex
+	locks map[string]*keyLockEntry
+}
+
+type keyLockEntry struct {
+	mu sync.Mutex
+	// refs counts the holder and the waiters of the mutex
+	refs int
+}
+
+// lock locks key and returns the function unlocking it
+func (l *keyLock) lock(key string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*keyLockEntry)
+	}
+	entry, ok := l.locks[key]
+	if !ok {
+		entry = &keyLockEntry{}
+		l.locks[key] = entry
+	}
+	entry.refs++
+	l.mu.Unlock()
+
+	entry.mu.Lock()
+	return func() {
+		entry.mu.Unlock()
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if entry.refs--; entry.refs == 0 {
+			delete(l.locks, key)
+		}
+	}
+}
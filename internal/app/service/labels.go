@@ -0,0 +1,262 @@
+package service
+
+import (
+	"regexp"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxLabels is the number of tags, and separately of labels, a document can carry
+const maxLabels = 64
+
+var (
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+	labelValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// ParseTags reads a comma separated list of tags such as "draft, q3"
+func ParseTags(s string) ([]string, error) {
+	tags := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags, ValidateLabels(&dao.DocumentLabels{Tags: tags})
+}
+
+// ParseLabels reads a comma separated list of labels such as "env=prod, team=infra"
+func ParseLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, label := range strings.Split(s, ",") {
+		if strings.TrimSpace(label) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(label, "=")
+		if !ok {
+			return nil, common.BadRequestError("label " + strings.TrimSpace(label) + " must be key=value")
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return labels, ValidateLabels(&dao.DocumentLabels{Labels: labels})
+}
+
+// ValidateLabels checks tags and label values are short words and label keys too, which can
+// also have a prefix like example.com/owner
+func ValidateLabels(labels *dao.DocumentLabels) error {
+	if len(labels.Tags) > maxLabels || len(labels.Labels) > maxLabels {
+		return common.BadRequestError("a document can have at most " + strconv.Itoa(maxLabels) + " tags and " + strconv.Itoa(maxLabels) + " labels")
+	}
+	for _, tag := range labels.Tags {
+		if tag == "" || !labelValuePattern.MatchString(tag) {
+			return common.BadRequestError("invalid tag " + strconv.Quote(tag))
+		}
+	}
+	for key, value := range labels.Labels {
+		if !labelKeyPattern.MatchString(key) {
+			return common.BadRequestError("invalid label key " + strconv.Quote(key))
+		}
+		if !labelValuePattern.MatchString(value) {
+			return common.BadRequestError("invalid value of label " + key)
+		}
+	}
+	return nil
+}
+
+// FormatLabels writes labels as ParseLabels reads them, sorted by key
+func FormatLabels(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+// Operators of the requirements of a label selector
+const (
+	selectorEquals    = "="
+	selectorNotEquals = "!="
+	selectorExists    = "exists"
+	selectorNotExists = "!exists"
+)
+
+type labelRequirement struct {
+	key      string
+	operator string
+	value    string
+}
+
+// LabelSelector selects documents by their labels and tags. All its requirements must be met.
+type LabelSelector struct {
+	requirements []labelRequirement
+	tags         []string
+}
+
+// ParseSelector reads a label selector such as "env=prod,team!=infra,owner,!archived", where
+// a bare key requires the label and !key its absence, and a comma separated list of tags
+// documents must all have. != also matches documents without the label.
+func ParseSelector(selector, tags string) (*LabelSelector, error) {
+	s := &LabelSelector{}
+	for _, part := range strings.Split(selector, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var r labelRequirement
+		if key, value, ok := strings.Cut(part, "!="); ok {
+			r = labelRequirement{key: key, operator: selectorNotEquals, value: value}
+		} else if key, value, ok := strings.Cut(part, "=="); ok {
+			r = labelRequirement{key: key, operator: selectorEquals, value: value}
+		} else if key, value, ok := strings.Cut(part, "="); ok {
+			r = labelRequirement{key: key, operator: selectorEquals, value: value}
+		} else if key, ok := strings.CutPrefix(part, "!"); ok {
+			r = labelRequirement{key: key, operator: selectorNotExists}
+		} else {
+			r = labelRequirement{key: part, operator: selectorExists}
+		}
+		r.key, r.value = strings.TrimSpace(r.key), strings.TrimSpace(r.value)
+		if !labelKeyPattern.MatchString(r.key) || !labelValuePattern.MatchString(r.value) {
+			return nil, common.BadRequestError("invalid label selector requirement " + strconv.Quote(part))
+		}
+		s.requirements = append(s.requirements, r)
+	}
+	var err error
+	if s.tags, err = ParseTags(tags); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Empty checks if the selector selects every document
+func (s *LabelSelector) Empty() bool {
+	return len(s.requirements) == 0 && len(s.tags) == 0
+}
+
+// Matches checks if a document with this metadata is selected
+func (s *LabelSelector) Matches(meta *dao.FileMetadata) bool {
+	for _, r := range s.requirements {
+		value, ok := meta.Labels[r.key]
+		switch r.operator {
+		case selectorEquals:
+			if !ok || value != r.value {
+				return false
+			}
+		case selectorNotEquals:
+			if ok && value == r.value {
+				return false
+			}
+		case selectorExists:
+			if !ok {
+				return false
+			}
+		case selectorNotExists:
+			if ok {
+				return false
+			}
+		}
+	}
+	for _, tag := range s.tags {
+		found := false
+		for _, t := range meta.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// GetLabels returns the tags and labels of a document
+func (fs *FileServiceImpl) GetLabels(username, docID string) (*dao.DocumentLabels, error) {
+	meta, ok := fs.ms.Get(username, docID)
+	if ok && expired(meta) {
+		return nil, common.NotFoundError("document not found")
+	}
+	if !ok {
+		// Documents stored before the broker kept metadata have no labels
+		if _, err := fs.fc.GetFile(username, docID); err != nil {
+			return nil, err
+		}
+		meta = &dao.FileMetadata{}
+	}
+	labels := &dao.DocumentLabels{Tags: meta.Tags, Labels: meta.Labels}
+	if labels.Tags == nil {
+		labels.Tags = make([]string, 0)
+	}
+	if labels.Labels == nil {
+		labels.Labels = make(map[string]string)
+	}
+	return labels, nil
+}
+
+// SetLabels replaces the tags and labels of a document without writing its content again
+func (fs *FileServiceImpl) SetLabels(username, docID string, labels *dao.DocumentLabels) error {
+	if err := ValidateLabels(labels); err != nil {
+		return err
+	}
+	unlock := fs.lockDocument(username, docID)
+	defer unlock()
+
+	meta, ok := fs.ms.Get(username, docID)
+	if ok && expired(meta) {
+		return common.NotFoundError("document not found")
+	}
+	if !ok {
+		content, err := fs.fc.GetFile(username, docID)
+		if err != nil {
+			return err
+		}
+		meta = &dao.FileMetadata{Size: len(content.Content)}
+	}
+	meta.Tags, meta.Labels = labels.Tags, labels.Labels
+	if err := fs.ms.Put(username, docID, *meta); err != nil {
+		return err
+	}
+	fs.notifyLabelsSet(username, docID, labels)
+	return nil
+}
+
+// LabelListener is told about the labels set on a document, which are not a write of it
+type LabelListener interface {
+	LabelsSet(username, docID string, labels *dao.DocumentLabels)
+}
+
+func (fs *FileServiceImpl) notifyLabelsSet(username, docID string, labels *dao.DocumentLabels) {
+	for _, l := range fs.listeners {
+		if ll, ok := l.(LabelListener); ok {
+			ll.LabelsSet(username, docID, labels)
+		}
+	}
+}
+
+// FindUserDocs returns the documents of a user the selector matches, as GetAllUserDocs does.
+// Documents stored before the broker kept metadata have no labels.
+func (fs *FileServiceImpl) FindUserDocs(username string, selector *LabelSelector) (*map[string]string, error) {
+	docs, err := fs.GetAllUserDocs(username)
+	if err != nil {
+		return nil, err
+	}
+	if selector.Empty() {
+		return docs, nil
+	}
+	metas := fs.ms.List(username)
+	for docID := range *docs {
+		meta := metas[docID]
+		if !selector.Matches(&meta) {
+			delete(*docs, docID)
+		}
+	}
+	return docs, nil
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"strings"
+)
+
+// Media types of the patch documents accepted by PATCH
+const (
+	PatchTypeMerge = "application/merge-patch+json"
+	PatchTypeJSON  = "application/json-patch+json"
+)
+
+type PatchServiceImpl struct {
+	fs FileService
+}
+
+func NewPatchService(fs FileService) *PatchServiceImpl {
+	return &PatchServiceImpl{fs: fs}
+}
+
+type PatchService interface {
+	Patch(username, docID, patchType string, patch []byte, ifMatch string, customerKey []byte) (*dao.FileSize, string, error)
+}
+
+// maxWriteAttempts bounds how many times a read-modify-write is tried again when the document
+// changes between the read and the write
+const maxWriteAttempts = 5
+
+// Patch applies a JSON Merge Patch or JSON Patch to a JSON document and writes the result through
+// UpdateFile, returning its size and new ETag. If ifMatch is set, the document is only patched
+// while its ETag is one of those listed, so that concurrent writers do not lose updates. Without
+// it, the patch is applied again to the new content when another write comes in between.
+func (svc *PatchServiceImpl) Patch(username, docID, patchType string, patch []byte, ifMatch string, customerKey []byte) (*dao.FileSize, string, error) {
+	// The patch is decoded again for every attempt, as applying it can share its values with the document
+	var apply func(doc interface{}) (interface{}, error)
+	switch patchType {
+	case PatchTypeMerge:
+		if _, err := decodeJSON(patch); err != nil {
+			return nil, "", common.BadRequestError("invalid merge patch")
+		}
+		apply = func(doc interface{}) (interface{}, error) {
+			p, err := decodeJSON(patch)
+			return mergePatch(doc, p), err
+		}
+	case PatchTypeJSON:
+		var ops []jsonPatchOp
+		if err := json.Unmarshal(patch, &ops); err != nil {
+			return nil, "", common.BadRequestError("invalid JSON patch, it must be an array of operations")
+		}
+		apply = func(doc interface{}) (interface{}, error) {
+			var ops []jsonPatchOp
+			if err := json.Unmarshal(patch, &ops); err != nil {
+				return nil, err
+			}
+			return jsonPatch(doc, ops)
+		}
+	default:
+		return nil, "", common.UnsupportedMediaTypeError("patch content type must be " + PatchTypeMerge + " or " + PatchTypeJSON)
+	}
+
+	for attempt := 1; ; attempt++ {
+		size, etag, err := svc.patch(username, docID, apply, ifMatch, customerKey)
+		if ifMatch != "" || attempt == maxWriteAttempts || !isPreconditionFailed(err) {
+			return size, etag, err
+		}
+	}
+}
+
+func (svc *PatchServiceImpl) patch(username, docID string, apply func(doc interface{}) (interface{}, error), ifMatch string, customerKey []byte) (*dao.FileSize, string, error) {
+	current, err := svc.fs.GetFileWithKey(username, docID, customerKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if ifMatch != "" && !MatchETag(ifMatch, ETag(current)) {
+		return nil, "", common.PreconditionFailedError("document has changed, its ETag does not match If-Match")
+	}
+	doc, err := decodeJSON(current.Content)
+	if err != nil {
+		return nil, "", common.UnprocessableEntityError("document is not JSON and cannot be patched", nil)
+	}
+	if doc, err = apply(doc); err != nil {
+		return nil, "", err
+	}
+	content, err := encodeJSON(doc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The stored content type and expiry are kept, the document is scanned and validated again
+	patched := &dao.Document{
+		Content:     content,
+		Metadata:    dao.FileMetadata{ContentType: current.Metadata.ContentType},
+		CustomerKey: customerKey,
+		IfMatch:     ETag(current),
+	}
+	size, err := svc.fs.UpdateFile(username, docID, patched)
+	if err != nil {
+		return nil, "", err
+	}
+	return size, ETag(patched), nil
+}
+
+// ETag returns the entity tag of a document, its quoted checksum
+func ETag(doc *dao.Document) string {
+	return `"` + DocumentChecksum(doc) + `"`
+}
+
+func isPreconditionFailed(err error) bool {
+	return err != nil && common.ToAPIError(err).StatusCode == http.StatusPreconditionFailed
+}
+
+// MatchETag checks an If-Match header against the entity tag of a document. Weak tags are
+// accepted too, the only weak tags the broker sends are those of compressed responses.
+func MatchETag(ifMatch, etag string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
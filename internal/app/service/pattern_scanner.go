@@ -0,0 +1,113 @@
+package service
+
+import (
+	"math/big"
+	"regexp"
+	"seg-red-broker/internal/app/dao"
+	"strconv"
+	"strings"
+)
+
+// patternRule finds one kind of secret or personal data. Matches are confirmed by check, if
+// set, to discard the numbers that only look like card numbers, IBANs or DNIs.
+type patternRule struct {
+	name     string
+	category string
+	re       *regexp.Regexp
+	check    func(match string) bool
+}
+
+var patternRules = []patternRule{
+	{name: "aws-access-key-id", category: ScanCategorySecret, re: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{name: "private-key", category: ScanCategorySecret, re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+	{name: "github-token", category: ScanCategorySecret, re: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`)},
+	{name: "slack-token", category: ScanCategorySecret, re: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{name: "jwt", category: ScanCategorySecret, re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{name: "email", category: ScanCategoryPII, re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	{name: "credit-card", category: ScanCategoryPII, re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), check: luhnValid},
+	{name: "iban", category: ScanCategoryPII, re: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){3,7}(?: ?[A-Z0-9]{1,3})?\b`), check: ibanValid},
+	{name: "dni", category: ScanCategoryPII, re: regexp.MustCompile(`\b\d{8}-?[A-Z]\b`), check: dniValid},
+}
+
+// PatternScanner looks for secrets and personal data with regular expressions
+type PatternScanner struct {
+	rules []patternRule
+}
+
+// NewPatternScanner creates a PatternScanner with the built-in rules of the given categories
+func NewPatternScanner(categories ...string) *PatternScanner {
+	s := &PatternScanner{}
+	for _, rule := range patternRules {
+		for _, category := range categories {
+			if rule.category == category {
+				s.rules = append(s.rules, rule)
+			}
+		}
+	}
+	return s
+}
+
+func (s *PatternScanner) Name() string {
+	return "patterns"
+}
+
+func (s *PatternScanner) Scan(content []byte) ([]dao.ScanFinding, error) {
+	var findings []dao.ScanFinding
+	for _, rule := range s.rules {
+		count := 0
+		for _, match := range rule.re.FindAll(content, -1) {
+			if rule.check == nil || rule.check(string(match)) {
+				count++
+			}
+		}
+		if count > 0 {
+			findings = append(findings, dao.ScanFinding{Scanner: s.Name(), Category: rule.category, Rule: rule.name, Count: count})
+		}
+	}
+	return findings, nil
+}
+
+// luhnValid checks the Luhn checksum of a card number
+func luhnValid(match string) bool {
+	sum, double := 0, false
+	for i := len(match) - 1; i >= 0; i-- {
+		if match[i] < '0' || match[i] > '9' {
+			continue
+		}
+		d := int(match[i] - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// ibanValid checks the ISO 13616 mod 97 checksum of an IBAN
+func ibanValid(match string) bool {
+	iban := strings.ReplaceAll(match, " ", "")
+	rearranged := iban[4:] + iban[:4]
+	var digits strings.Builder
+	for _, r := range rearranged {
+		if r >= 'A' && r <= 'Z' {
+			digits.WriteString(strconv.Itoa(int(r-'A') + 10))
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && n.Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// dniValid checks the control letter of a Spanish DNI
+func dniValid(match string) bool {
+	const letters = "TRWAGMYFPDXBNJZSQVHLCKE"
+	n := 0
+	for _, r := range match[:8] {
+		n = n*10 + int(r-'0')
+	}
+	return match[len(match)-1] == letters[n%23]
+}
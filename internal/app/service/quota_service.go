@@ -0,0 +1,221 @@
+package service
+
+import (
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/store"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type QuotaServiceImpl struct {
+	fs       FileService
+	us       *store.UsageStore
+	qs       *store.QuotaStore
+	defaults dao.Quota
+	// trash keeps deleted documents that count against the quota until they are purged
+	trash TrashService
+}
+
+// NewQuotaService creates a QuotaService and starts the periodic usage reconciliation
+func NewQuotaService(fs FileService, us *store.UsageStore, qs *store.QuotaStore) *QuotaServiceImpl {
+	svc := &QuotaServiceImpl{
+		fs: fs,
+		us: us,
+		qs: qs,
+		defaults: dao.Quota{
+			MaxBytes:        common.GetEnvInt64("QUOTA_MAX_BYTES", 0),
+			MaxDocuments:    common.GetEnvInt64("QUOTA_MAX_DOCUMENTS", 0),
+			MaxDocumentSize: common.GetEnvInt64("QUOTA_MAX_DOCUMENT_SIZE", 0),
+		},
+	}
+	go svc.reconcileEvery(common.GetEnvDuration("QUOTA_RECONCILE_INTERVAL", time.Hour))
+	return svc
+}
+
+// EnableTrash makes the documents kept by trash count against the quota until they are purged
+func (svc *QuotaServiceImpl) EnableTrash(trash TrashService) {
+	svc.trash = trash
+}
+
+type QuotaService interface {
+	FileValidator
+	FileListener
+	TrashListener
+	GetUsage(username string) (*dao.UsageReport, error)
+	Reconcile(username string) error
+	ReconcileAll() error
+}
+
+// ValidateFile rejects a document that does not fit in the quota of its owner
+func (svc *QuotaServiceImpl) ValidateFile(username, docID string, doc *dao.Document) error {
+	quota := svc.quota(username)
+	size := int64(len(doc.Content))
+	if quota.MaxDocumentSize > 0 && size > quota.MaxDocumentSize {
+		return common.PayloadTooLargeError("document exceeds the maximum document size")
+	}
+
+	usage, err := svc.usage(username)
+	if err != nil {
+		return err
+	}
+	old, exists := usage.Sizes[docID]
+	documents := usage.Documents
+	if !exists {
+		documents++
+	}
+	if quota.MaxDocuments > 0 && documents > quota.MaxDocuments {
+		return common.InsufficientStorageError("document quota exceeded")
+	}
+	if quota.MaxBytes > 0 && usage.Bytes-int64(old)+size > quota.MaxBytes {
+		return common.InsufficientStorageError("storage quota exceeded")
+	}
+	return nil
+}
+
+// FileWritten accounts the size stored for a document
+func (svc *QuotaServiceImpl) FileWritten(username, docID string, doc *dao.Document, _ bool) {
+	err := svc.us.Update(username, func(u *dao.Usage) {
+		old, exists := u.Sizes[docID]
+		if !exists {
+			u.Documents++
+		}
+		u.Bytes += int64(doc.Metadata.Size - old)
+		u.Sizes[docID] = doc.Metadata.Size
+	})
+	if err != nil {
+		log.Error("Error saving usage: ", err)
+	}
+}
+
+// FileDeleted releases the size of a deleted document
+func (svc *QuotaServiceImpl) FileDeleted(username, docID string) {
+	err := svc.us.Update(username, func(u *dao.Usage) {
+		old, exists := u.Sizes[docID]
+		if !exists {
+			return
+		}
+		u.Documents--
+		u.Bytes -= int64(old)
+		delete(u.Sizes, docID)
+	})
+	if err != nil {
+		log.Error("Error saving usage: ", err)
+	}
+}
+
+// FileTrashed keeps counting the size of a document moved to the trash, FileDeleted has
+// released it as a document already
+func (svc *QuotaServiceImpl) FileTrashed(username string, item dao.TrashItem) {
+	err := svc.us.Update(username, func(u *dao.Usage) {
+		if u.Trashed == nil {
+			u.Trashed = make(map[string]int)
+		}
+		u.Bytes += int64(item.Size - u.Trashed[item.ID])
+		u.Trashed[item.ID] = item.Size
+	})
+	if err != nil {
+		log.Error("Error saving usage: ", err)
+	}
+}
+
+// TrashRemoved releases the size of a document purged or restored from the trash
+func (svc *QuotaServiceImpl) TrashRemoved(username string, item dao.TrashItem) {
+	err := svc.us.Update(username, func(u *dao.Usage) {
+		old, exists := u.Trashed[item.ID]
+		if !exists {
+			return
+		}
+		u.Bytes -= int64(old)
+		delete(u.Trashed, item.ID)
+	})
+	if err != nil {
+		log.Error("Error saving usage: ", err)
+	}
+}
+
+// GetUsage returns the usage of a user and the quota that applies
+func (svc *QuotaServiceImpl) GetUsage(username string) (*dao.UsageReport, error) {
+	usage, err := svc.usage(username)
+	if err != nil {
+		return nil, err
+	}
+	var trashBytes int64
+	for _, size := range usage.Trashed {
+		trashBytes += int64(size)
+	}
+	return &dao.UsageReport{
+		Username:     username,
+		Bytes:        usage.Bytes,
+		TrashBytes:   trashBytes,
+		Documents:    usage.Documents,
+		Quota:        svc.quota(username),
+		ReconciledAt: usage.ReconciledAt,
+	}, nil
+}
+
+// Reconcile recomputes the usage of a user from every document in the file service and in the trash
+func (svc *QuotaServiceImpl) Reconcile(username string) error {
+	sizes, err := svc.fs.GetUserDocSizes(username)
+	if err != nil {
+		return err
+	}
+	usage := dao.Usage{Sizes: make(map[string]int, len(sizes)), ReconciledAt: time.Now().UTC()}
+	for docID, size := range sizes {
+		usage.Sizes[docID] = size
+		usage.Bytes += int64(size)
+		usage.Documents++
+	}
+	if svc.trash != nil {
+		usage.Trashed = make(map[string]int)
+		for _, item := range svc.trash.List(username) {
+			usage.Trashed[item.ID] = item.Size
+			usage.Bytes += int64(item.Size)
+		}
+	}
+	if old, ok := svc.us.Get(username); ok && (old.Bytes != usage.Bytes || old.Documents != usage.Documents) {
+		log.Infof("Reconciled usage of %s from %d bytes in %d documents to %d bytes in %d documents",
+			username, old.Bytes, old.Documents, usage.Bytes, usage.Documents)
+	}
+	return svc.us.Put(username, usage)
+}
+
+// ReconcileAll reconciles every tracked user and reloads the quota overrides
+func (svc *QuotaServiceImpl) ReconcileAll() error {
+	svc.qs.Reload()
+	for _, username := range svc.us.Usernames() {
+		if err := svc.Reconcile(username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usage returns the usage of a user, computing it the first time the user is seen
+func (svc *QuotaServiceImpl) usage(username string) (dao.Usage, error) {
+	if usage, ok := svc.us.Get(username); ok {
+		return usage, nil
+	}
+	if err := svc.Reconcile(username); err != nil {
+		return dao.Usage{}, err
+	}
+	usage, _ := svc.us.Get(username)
+	return usage, nil
+}
+
+// quota returns the override of a user or the default quota
+func (svc *QuotaServiceImpl) quota(username string) dao.Quota {
+	if q, ok := svc.qs.Get(username); ok {
+		return q
+	}
+	return svc.defaults
+}
+
+func (svc *QuotaServiceImpl) reconcileEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := svc.ReconcileAll(); err != nil {
+			log.Error("Error reconciling usage: ", err)
+		}
+	}
+}
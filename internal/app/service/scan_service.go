@@ -0,0 +1,149 @@
+package service
+
+import (
+	"bytes"
+	"os"
+	"seg-red-broker/internal/app/client"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Categories of the findings of the scanners
+const (
+	ScanCategoryMalware = "malware"
+	ScanCategorySecret  = "secret"
+	ScanCategoryPII     = "pii"
+)
+
+// Outcomes of a scan, from the mildest to the strictest. Blocked documents are rejected,
+// quarantined ones are stored but cannot be read and tagged ones are stored with their findings.
+const (
+	ScanOutcomeTag        = "tag"
+	ScanOutcomeQuarantine = "quarantine"
+	ScanOutcomeBlock      = "block"
+)
+
+var scanOutcomeSeverity = map[string]int{ScanOutcomeTag: 1, ScanOutcomeQuarantine: 2, ScanOutcomeBlock: 3}
+
+// Scanner inspects the content of a document about to be written
+type Scanner interface {
+	Name() string
+	Scan(content []byte) ([]dao.ScanFinding, error)
+}
+
+type ScanServiceImpl struct {
+	scanners []Scanner
+	// policies maps the categories of findings to the outcome they lead to
+	policies map[string]string
+	failOpen bool
+}
+
+// NewScanService creates a ScanService with the scanners and policies configured in the
+// environment: clamd when CLAMD_ADDRESS is set and the pattern scanner for the secret and
+// pii categories that have a policy
+func NewScanService() *ScanServiceImpl {
+	svc := &ScanServiceImpl{
+		policies: make(map[string]string),
+		failOpen: os.Getenv("SCAN_FAIL_OPEN") == "true",
+	}
+	for _, category := range []string{ScanCategoryMalware, ScanCategorySecret, ScanCategoryPII} {
+		policy := os.Getenv("SCAN_POLICY_" + strings.ToUpper(category))
+		if policy == "" {
+			continue
+		}
+		if _, ok := scanOutcomeSeverity[policy]; !ok {
+			log.Warnf("Unsupported scan policy %q for %s findings, they are blocked", policy, category)
+			policy = ScanOutcomeBlock
+		}
+		svc.policies[category] = policy
+	}
+
+	if clamd := client.NewClamdClient(); clamd != nil {
+		svc.AddScanner(&ClamdScanner{clamd: clamd})
+		if svc.policies[ScanCategoryMalware] == "" {
+			svc.policies[ScanCategoryMalware] = ScanOutcomeBlock
+		}
+	}
+	var categories []string
+	for _, category := range []string{ScanCategorySecret, ScanCategoryPII} {
+		if svc.policies[category] != "" {
+			categories = append(categories, category)
+		}
+	}
+	if len(categories) > 0 {
+		svc.AddScanner(NewPatternScanner(categories...))
+	}
+	return svc
+}
+
+type ScanService interface {
+	FileValidator
+	AddScanner(s Scanner)
+}
+
+// AddScanner registers a scanner for every later document write
+func (svc *ScanServiceImpl) AddScanner(s Scanner) {
+	svc.scanners = append(svc.scanners, s)
+}
+
+// ValidateFile runs every scanner on a document. Blocked documents are rejected with the
+// verdict, the others keep it in their metadata to be quarantined or tagged.
+func (svc *ScanServiceImpl) ValidateFile(username, docID string, doc *dao.Document) error {
+	doc.Metadata.Scan = nil
+	if len(svc.scanners) == 0 {
+		return nil
+	}
+
+	result := &dao.ScanResult{Findings: make([]dao.ScanFinding, 0), ScannedAt: time.Now().UTC()}
+	for _, s := range svc.scanners {
+		findings, err := s.Scan(doc.Content)
+		if err != nil {
+			log.Errorf("Error scanning %s/%s with %s: %v", username, docID, s.Name(), err)
+			if svc.failOpen {
+				continue
+			}
+			return common.ServiceUnavailableError("content scanning is unavailable")
+		}
+		for _, f := range findings {
+			outcome := svc.policies[f.Category]
+			if outcome == "" {
+				continue
+			}
+			result.Findings = append(result.Findings, f)
+			if scanOutcomeSeverity[outcome] > scanOutcomeSeverity[result.Outcome] {
+				result.Outcome = outcome
+			}
+		}
+	}
+	if result.Outcome == "" {
+		return nil
+	}
+
+	log.Infof("Scan of %s/%s: %s with %d findings", username, docID, result.Outcome, len(result.Findings))
+	if result.Outcome == ScanOutcomeBlock {
+		return common.UnprocessableEntityError("document rejected by content scanning", result)
+	}
+	doc.Metadata.Scan = result
+	return nil
+}
+
+// ClamdScanner finds malware with a ClamAV daemon
+type ClamdScanner struct {
+	clamd *client.ClamdClient
+}
+
+func (s *ClamdScanner) Name() string {
+	return "clamd"
+}
+
+func (s *ClamdScanner) Scan(content []byte) ([]dao.ScanFinding, error) {
+	signature, err := s.clamd.Scan(bytes.NewReader(content))
+	if err != nil || signature == "" {
+		return nil, err
+	}
+	return []dao.ScanFinding{{Scanner: s.Name(), Category: ScanCategoryMalware, Rule: signature, Count: 1}}, nil
+}
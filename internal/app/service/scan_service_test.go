@@ -0,0 +1,117 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"strings"
+	"testing"
+)
+
+// fakeScanner finds match in the contents, under category, or fails with err
+type fakeScanner struct {
+	category string
+	match    string
+	err      error
+}
+
+func (s *fakeScanner) Name() string {
+	return "fake"
+}
+
+func (s *fakeScanner) Scan(content []byte) ([]dao.ScanFinding, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	n := strings.Count(string(content), s.match)
+	if n == 0 {
+		return nil, nil
+	}
+	return []dao.ScanFinding{{Scanner: s.Name(), Category: s.category, Rule: s.match, Count: n}}, nil
+}
+
+func newTestScanService(policy string, scanners ...Scanner) *ScanServiceImpl {
+	svc := &ScanServiceImpl{policies: map[string]string{ScanCategoryMalware: policy}}
+	for _, s := range scanners {
+		svc.AddScanner(s)
+	}
+	return svc
+}
+
+func TestScanBlock(t *testing.T) {
+	svc := newTestScanService(ScanOutcomeBlock, &fakeScanner{category: ScanCategoryMalware, match: "EICAR"})
+
+	err := svc.ValidateFile("ana", "doc", &dao.Document{Content: []byte("EICAR test")})
+	if status := common.ToAPIError(err).StatusCode; status != http.StatusUnprocessableEntity {
+		t.Fatalf("blocked document: status %d, want %d", status, http.StatusUnprocessableEntity)
+	}
+	clean := &dao.Document{Content: []byte("hello")}
+	if err := svc.ValidateFile("ana", "doc", clean); err != nil || clean.Metadata.Scan != nil {
+		t.Fatalf("clean document: err %v, scan %+v, want neither", err, clean.Metadata.Scan)
+	}
+}
+
+func TestScanQuarantine(t *testing.T) {
+	fs, backend := newTestFileService(t)
+	fs.AddValidator(newTestScanService(ScanOutcomeQuarantine, &fakeScanner{category: ScanCategoryMalware, match: "EICAR"}))
+
+	if _, err := fs.CreateFile("ana", "doc", &dao.Document{Content: []byte("EICAR test")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := backend.Stored("ana", "doc"); !ok {
+		t.Fatal("quarantined document was not stored")
+	}
+	_, err := fs.GetFile("ana", "doc")
+	if status := common.ToAPIError(err).StatusCode; status != http.StatusForbidden {
+		t.Fatalf("reading a quarantined document: status %d, want %d", status, http.StatusForbidden)
+	}
+	meta, _ := fs.ms.Get("ana", "doc")
+	if meta.Scan == nil || meta.Scan.Outcome != ScanOutcomeQuarantine || len(meta.Scan.Findings) != 1 {
+		t.Fatalf("scan result %+v, want a quarantine with one finding", meta.Scan)
+	}
+}
+
+func TestScanTag(t *testing.T) {
+	fs, _ := newTestFileService(t)
+	fs.AddValidator(newTestScanService(ScanOutcomeTag, &fakeScanner{category: ScanCategoryMalware, match: "EICAR"}))
+
+	if _, err := fs.CreateFile("ana", "doc", &dao.Document{Content: []byte("EICAR EICAR")}); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := fs.GetFile("ana", "doc")
+	if err != nil {
+		t.Fatalf("reading a tagged document: %v", err)
+	}
+	scan := doc.Metadata.Scan
+	if scan == nil || scan.Outcome != ScanOutcomeTag || scan.Findings[0].Count != 2 {
+		t.Fatalf("scan result %+v, want a tag with a finding counted twice", scan)
+	}
+}
+
+func TestScanStrictestOutcomeWins(t *testing.T) {
+	svc := newTestScanService(ScanOutcomeQuarantine, &fakeScanner{category: ScanCategoryMalware, match: "EICAR"})
+	svc.policies[ScanCategorySecret] = ScanOutcomeTag
+	svc.AddScanner(&fakeScanner{category: ScanCategorySecret, match: "password"})
+
+	doc := &dao.Document{Content: []byte("password EICAR")}
+	if err := svc.ValidateFile("ana", "doc", doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.Metadata.Scan.Outcome != ScanOutcomeQuarantine || len(doc.Metadata.Scan.Findings) != 2 {
+		t.Fatalf("scan result %+v, want a quarantine with both findings", doc.Metadata.Scan)
+	}
+}
+
+func TestScanUnavailable(t *testing.T) {
+	svc := newTestScanService(ScanOutcomeBlock, &fakeScanner{err: errors.New("connection refused")})
+
+	err := svc.ValidateFile("ana", "doc", &dao.Document{Content: []byte("hello")})
+	if status := common.ToAPIError(err).StatusCode; status != http.StatusServiceUnavailable {
+		t.Fatalf("failing closed: status %d, want %d", status, http.StatusServiceUnavailable)
+	}
+	svc.failOpen = true
+	if err := svc.ValidateFile("ana", "doc", &dao.Document{Content: []byte("hello")}); err != nil {
+		t.Fatalf("failing open: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/store"
+	"sync"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+type SchemaServiceImpl struct {
+	ss       *store.SchemaStore
+	mu       sync.Mutex
+	compiled map[string]*jsonschema.Schema
+}
+
+func NewSchemaService(ss *store.SchemaStore) *SchemaServiceImpl {
+	return &SchemaServiceImpl{ss: ss, compiled: make(map[string]*jsonschema.Schema)}
+}
+
+type SchemaService interface {
+	FileValidator
+	ListSchemas(username string) []dao.DocumentSchema
+	PutSchema(username, id, pattern string, schema json.RawMessage) (*dao.DocumentSchema, error)
+	DeleteSchema(username, id string) error
+}
+
+// ListSchemas returns the schemas attached by a user
+func (svc *SchemaServiceImpl) ListSchemas(username string) []dao.DocumentSchema {
+	return svc.ss.List(username)
+}
+
+// PutSchema attaches a schema to the doc IDs matching a path.Match pattern, replacing any schema with the same ID
+func (svc *SchemaServiceImpl) PutSchema(username, id, pattern string, schema json.RawMessage) (*dao.DocumentSchema, error) {
+	if pattern == "" {
+		return nil, common.EmptyParamsError("pattern")
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, common.BadRequestError("invalid doc ID pattern")
+	}
+	compiled, err := compileSchema(schema)
+	if err != nil {
+		return nil, common.BadRequestError("invalid JSON Schema: " + err.Error())
+	}
+
+	doc := dao.DocumentSchema{ID: id, Pattern: pattern, Schema: schema, UpdatedAt: time.Now().UTC()}
+	if err := svc.ss.Put(username, doc); err != nil {
+		return nil, err
+	}
+	svc.mu.Lock()
+	svc.compiled[schemaKey(username, id)] = compiled
+	svc.mu.Unlock()
+	return &doc, nil
+}
+
+// DeleteSchema detaches a schema
+func (svc *SchemaServiceImpl) DeleteSchema(username, id string) error {
+	found, err := svc.ss.Delete(username, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return common.NotFoundError("schema not found")
+	}
+	svc.mu.Lock()
+	delete(svc.compiled, schemaKey(username, id))
+	svc.mu.Unlock()
+	return nil
+}
+
+// ValidateFile checks a document against every schema whose pattern matches its doc ID,
+// reporting all the violations found
+func (svc *SchemaServiceImpl) ValidateFile(username, docID string, doc *dao.Document) error {
+	var instance interface{}
+	parsed := false
+	violations := make([]dao.SchemaViolation, 0)
+	for _, schema := range svc.ss.List(username) {
+		if ok, _ := path.Match(schema.Pattern, docID); !ok {
+			continue
+		}
+		if !parsed {
+			decoder := json.NewDecoder(bytes.NewReader(doc.Content))
+			decoder.UseNumber()
+			if err := decoder.Decode(&instance); err != nil || decoder.Decode(new(interface{})) != io.EOF {
+				return common.UnprocessableEntityError("document is not valid JSON", []dao.SchemaViolation{
+					{SchemaID: schema.ID, Pointer: "", Message: "invalid JSON"},
+				})
+			}
+			parsed = true
+		}
+
+		compiled, err := svc.compile(username, schema)
+		if err != nil {
+			return err
+		}
+		var ve *jsonschema.ValidationError
+		if err := compiled.Validate(instance); errors.As(err, &ve) {
+			violations = appendViolations(violations, schema.ID, ve)
+		} else if err != nil {
+			return err
+		}
+	}
+	if len(violations) > 0 {
+		return common.UnprocessableEntityError("document does not match its JSON Schema", violations)
+	}
+	return nil
+}
+
+// compile returns the compiled form of a schema, compiling it the first time it is used
+func (svc *SchemaServiceImpl) compile(username string, schema dao.DocumentSchema) (*jsonschema.Schema, error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	key := schemaKey(username, schema.ID)
+	if compiled, ok := svc.compiled[key]; ok {
+		return compiled, nil
+	}
+	compiled, err := compileSchema(schema.Schema)
+	if err != nil {
+		return nil, err
+	}
+	svc.compiled[key] = compiled
+	return compiled, nil
+}
+
+// compileSchema compiles a user supplied schema. References to external resources are not
+// followed, so that schemas cannot read local files or reach other hosts.
+func compileSchema(schema json.RawMessage) (*jsonschema.Schema, error) {
+	const url = "mem:///schema.json"
+	c := jsonschema.NewCompiler()
+	c.LoadURL = func(s string) (io.ReadCloser, error) {
+		return nil, errors.New("external references are not allowed: " + s)
+	}
+	if err := c.AddResource(url, bytes.NewReader(schema)); err != nil {
+		return nil, err
+	}
+	return c.Compile(url)
+}
+
+// appendViolations flattens a validation error into its leaf causes
+func appendViolations(violations []dao.SchemaViolation, schemaID string, ve *jsonschema.ValidationError) []dao.SchemaViolation {
+	if len(ve.Causes) == 0 {
+		return append(violations, dao.SchemaViolation{SchemaID: schemaID, Pointer: ve.InstanceLocation, Message: ve.Message})
+	}
+	for _, cause := range ve.Causes {
+		violations = appendViolations(violations, schemaID, cause)
+	}
+	return violations
+}
+
+func schemaKey(username, id string) string {
+	return username + "/" + id
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type ScrubServiceImpl struct {
+	fs FileService
+}
+
+func NewScrubService(fs FileService) *ScrubServiceImpl {
+	return &ScrubServiceImpl{fs: fs}
+}
+
+type ScrubService interface {
+	Scrub(username string) (*dao.ScrubReport, error)
+}
+
+// Scrub reads every document of a user back from the file service and compares its content
+// with the checksum recorded when it was written. Only the doc IDs are taken from the listing,
+// each document is then decoded and checked on its own, so one that cannot be read any more is
+// reported instead of failing the scrub.
+func (svc *ScrubServiceImpl) Scrub(username string) (*dao.ScrubReport, error) {
+	sizes, err := svc.fs.GetUserDocSizes(username)
+	if err != nil {
+		return nil, err
+	}
+	docIDs := make([]string, 0, len(sizes))
+	for docID := range sizes {
+		docIDs = append(docIDs, docID)
+	}
+	sort.Strings(docIDs)
+
+	report := &dao.ScrubReport{
+		Username:   username,
+		ScrubbedAt: time.Now().UTC(),
+		Drifted:    make([]dao.ScrubEntry, 0),
+		Errors:     make([]dao.ScrubEntry, 0),
+	}
+	for _, docID := range docIDs {
+		doc, err := svc.fs.GetFile(username, docID)
+		if err != nil {
+			if common.ToAPIError(err).StatusCode == http.StatusForbidden {
+				report.Skipped++
+				continue
+			}
+			// Contents that cannot be decoded or decrypted any more have drifted too
+			report.Errors = append(report.Errors, dao.ScrubEntry{DocID: docID, Error: common.PublicError(err)})
+			continue
+		}
+		report.Checked++
+		actual := Checksum(doc.Content)
+		if doc.Metadata.SHA256 == "" {
+			if err := svc.fs.RecordChecksum(username, docID, doc.Content); err != nil {
+				return nil, err
+			}
+			report.Recorded++
+			continue
+		}
+		if actual != doc.Metadata.SHA256 {
+			report.Drifted = append(report.Drifted, dao.ScrubEntry{DocID: docID, Expected: doc.Metadata.SHA256, Actual: actual})
+		}
+	}
+	if len(report.Drifted) > 0 || len(report.Errors) > 0 {
+		log.Warnf("Scrub of %s found %d drifted and %d unreadable documents", username, len(report.Drifted), len(report.Errors))
+	}
+	return report, nil
+}
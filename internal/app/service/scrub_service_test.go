@@ -0,0 +1,43 @@
+package service
+
+import (
+	"seg-red-broker/internal/app/dao"
+	"testing"
+)
+
+func TestScrubReportsEachDocument(t *testing.T) {
+	fs, backend := newTestFileService(t)
+	for _, docID := range []string{"clean", "drifted", "unreadable"} {
+		if _, err := fs.CreateFile("ana", docID, &dao.Document{Content: []byte("content")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backend.Put("ana", "drifted", "bit rot")
+	// The stored content no longer decodes as the metadata says
+	err := fs.ms.Update("ana", "unreadable", func(meta *dao.FileMetadata) bool {
+		meta.Compression = "gzip"
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A document stored before the broker kept metadata gets its checksum recorded
+	backend.Put("ana", "legacy", "old content")
+
+	report, err := NewScrubService(fs).Scrub("ana")
+	if err != nil {
+		t.Fatalf("scrub with a document that cannot be decoded: %v", err)
+	}
+	if report.Checked != 3 || report.Recorded != 1 {
+		t.Errorf("checked %d and recorded %d, want 3 and 1", report.Checked, report.Recorded)
+	}
+	if len(report.Drifted) != 1 || report.Drifted[0].DocID != "drifted" || report.Drifted[0].Actual != Checksum([]byte("bit rot")) {
+		t.Errorf("drifted %+v, want the drifted document", report.Drifted)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].DocID != "unreadable" {
+		t.Errorf("errors %+v, want the unreadable document", report.Errors)
+	}
+	if meta, _ := fs.ms.Get("ana", "legacy"); meta == nil || meta.SHA256 != Checksum([]byte("old content")) {
+		t.Errorf("metadata of the legacy document %+v, want its checksum recorded", meta)
+	}
+}
@@ -0,0 +1,389 @@
+package service
+
+import (
+	"html"
+	"math"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/store"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Highlight marks placed around the matches in snippets
+const (
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+)
+
+const (
+	maxSnippets    = 3
+	snippetContext = 40
+)
+
+type SearchServiceImpl struct {
+	locks keyLock
+	fs    FileService
+	ss    *store.SearchStore
+}
+
+func NewSearchService(fs FileService, ss *store.SearchStore) *SearchServiceImpl {
+	return &SearchServiceImpl{fs: fs, ss: ss}
+}
+
+type SearchService interface {
+	FileListener
+	Search(username, query string, limit int) ([]dao.SearchResult, error)
+	Rebuild(username string) error
+}
+
+// token is a word of a document and its byte offsets
+type token struct {
+	term       string
+	start, end int
+}
+
+// queryClause is either a single term or a phrase. The last term of a prefix clause
+// matches every term starting with it.
+type queryClause struct {
+	terms  []string
+	prefix bool
+}
+
+// FileWritten indexes a document after it has been created or updated
+func (svc *SearchServiceImpl) FileWritten(username, docID string, doc *dao.Document, _ bool) {
+	change := dao.SearchIndexChange{DocID: docID}
+	if indexable(&doc.Metadata) {
+		change = documentChange(docID, doc.Content)
+	}
+	svc.apply(username, change)
+}
+
+// indexable tells whether a document may be indexed. The index is stored in plain text and
+// would reveal the content of encrypted documents, whichever key encrypts them, and quarantined
+// documents must not be found.
+func indexable(meta *dao.FileMetadata) bool {
+	return meta.Encryption == nil && (meta.Scan == nil || meta.Scan.Outcome != ScanOutcomeQuarantine)
+}
+
+// FileDeleted removes a document from the index
+func (svc *SearchServiceImpl) FileDeleted(username, docID string) {
+	svc.apply(username, dao.SearchIndexChange{DocID: docID})
+}
+
+func (svc *SearchServiceImpl) apply(username string, change dao.SearchIndexChange) {
+	unlock := svc.locks.lock(username)
+	defer unlock()
+	idx, err := svc.load(username)
+	if err != nil {
+		log.Error("Error loading search index: ", err)
+		return
+	}
+	if err := svc.ss.Apply(username, idx, change); err != nil {
+		log.Error("Error saving search index: ", err)
+	}
+}
+
+// Rebuild indexes again every document of a user from the file service, those stored before
+// the broker kept metadata included
+func (svc *SearchServiceImpl) Rebuild(username string) error {
+	unlock := svc.locks.lock(username)
+	defer unlock()
+	return svc.rebuild(username)
+}
+
+// Search returns the documents matching every clause of the query, best matches first.
+// Quoted text is searched as a phrase and a trailing * makes the last word a prefix.
+func (svc *SearchServiceImpl) Search(username, query string, limit int) ([]dao.SearchResult, error) {
+	clauses := parseQuery(query)
+	if len(clauses) == 0 {
+		return nil, common.EmptyParamsError("q")
+	}
+
+	unlock := svc.locks.lock(username)
+	idx, err := svc.load(username)
+	var scores map[string]float64
+	if err == nil {
+		scores = score(idx, clauses)
+	}
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]dao.SearchResult, 0, len(scores))
+	for docID, s := range scores {
+		results = append(results, dao.SearchResult{DocID: docID, Score: s})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].DocID < results[j].DocID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	// Snippets are built from the current content, only for the returned documents
+	for i := range results {
+		results[i].Snippets = make([]string, 0)
+		doc, err := svc.fs.GetFile(username, results[i].DocID)
+		if err != nil {
+			log.Warnf("Error reading %s for snippets: %v", results[i].DocID, err)
+			continue
+		}
+		results[i].Snippets = snippets(doc.Content, clauses)
+	}
+	return results, nil
+}
+
+// load returns the index of a user, building it from the file service the first time
+func (svc *SearchServiceImpl) load(username string) (*dao.SearchIndex, error) {
+	idx, exists, err := svc.ss.Load(username)
+	if err != nil || exists {
+		return idx, err
+	}
+	if err := svc.rebuild(username); err != nil {
+		return nil, err
+	}
+	idx, _, err = svc.ss.Load(username)
+	return idx, err
+}
+
+func (svc *SearchServiceImpl) rebuild(username string) error {
+	idx := &dao.SearchIndex{
+		Lengths:  make(map[string]int),
+		Postings: make(map[string]map[string][]int),
+		Terms:    make(map[string][]string),
+	}
+	docIDs, err := svc.fs.ListDocIDs(username)
+	if err != nil {
+		return err
+	}
+	for _, docID := range docIDs {
+		doc, err := svc.fs.GetFile(username, docID)
+		if err != nil {
+			log.Warnf("Error reading %s while rebuilding the search index: %v", docID, err)
+			continue
+		}
+		if !indexable(&doc.Metadata) {
+			continue
+		}
+		store.ApplySearchChange(idx, documentChange(docID, doc.Content))
+	}
+	log.Infof("Rebuilt search index of %s with %d documents", username, len(idx.Lengths))
+	return svc.ss.Save(username, idx)
+}
+
+// documentChange indexes the tokens of a document. Binary documents and documents without
+// words are not indexed.
+func documentChange(docID string, content []byte) dao.SearchIndexChange {
+	change := dao.SearchIndexChange{DocID: docID}
+	if !utf8.Valid(content) {
+		return change
+	}
+	tokens := tokenize(string(content))
+	if len(tokens) == 0 {
+		return change
+	}
+	change.Length = len(tokens)
+	change.Postings = make(map[string][]int)
+	for pos, t := range tokens {
+		change.Postings[t.term] = append(change.Postings[t.term], pos)
+	}
+	return change
+}
+
+// tokenize splits text into lower case words made of letters and digits
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+func parseQuery(query string) []queryClause {
+	var clauses []queryClause
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			// Inside quotes: a phrase
+			clauses = appendClause(clauses, part)
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			clauses = appendClause(clauses, word)
+		}
+	}
+	return clauses
+}
+
+func appendClause(clauses []queryClause, text string) []queryClause {
+	prefix := strings.HasSuffix(strings.TrimSpace(text), "*")
+	var terms []string
+	for _, t := range tokenize(text) {
+		terms = append(terms, t.term)
+	}
+	if len(terms) == 0 {
+		return clauses
+	}
+	return append(clauses, queryClause{terms: terms, prefix: prefix})
+}
+
+// candidates returns the indexed terms that the i-th term of a clause can match
+func (q queryClause) candidates(idx *dao.SearchIndex, i int) []string {
+	if !q.prefix || i != len(q.terms)-1 {
+		return []string{q.terms[i]}
+	}
+	var terms []string
+	for term := range idx.Postings {
+		if strings.HasPrefix(term, q.terms[i]) {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// occurrences counts, per document, how many times a clause matches
+func occurrences(idx *dao.SearchIndex, q queryClause) map[string]int {
+	positions := make([]map[string]map[int]bool, len(q.terms))
+	for i := range q.terms {
+		positions[i] = make(map[string]map[int]bool)
+		for _, term := range q.candidates(idx, i) {
+			for docID, ps := range idx.Postings[term] {
+				if positions[i][docID] == nil {
+					positions[i][docID] = make(map[int]bool)
+				}
+				for _, p := range ps {
+					positions[i][docID][p] = true
+				}
+			}
+		}
+	}
+
+	counts := make(map[string]int)
+	for docID, starts := range positions[0] {
+		for start := range starts {
+			matched := true
+			for i := 1; i < len(q.terms) && matched; i++ {
+				matched = positions[i][docID][start+i]
+			}
+			if matched {
+				counts[docID]++
+			}
+		}
+	}
+	return counts
+}
+
+// score ranks the documents matching every clause with a length normalised tf-idf
+func score(idx *dao.SearchIndex, clauses []queryClause) map[string]float64 {
+	var scores map[string]float64
+	total := float64(len(idx.Lengths))
+	for _, q := range clauses {
+		counts := occurrences(idx, q)
+		idf := math.Log(1 + total/float64(len(counts)+1))
+		next := make(map[string]float64)
+		for docID, n := range counts {
+			if scores != nil {
+				if _, ok := scores[docID]; !ok {
+					continue
+				}
+			}
+			tf := float64(n) / math.Sqrt(float64(idx.Lengths[docID]))
+			next[docID] = scores[docID] + tf*idf
+		}
+		scores = next
+	}
+	return scores
+}
+
+// snippets extracts the text around the first matches of the query, with the matches
+// highlighted. The text is HTML escaped, only the highlight marks are markup.
+func snippets(content []byte, clauses []queryClause) []string {
+	text := string(content)
+	tokens := tokenize(text)
+	var matches [][2]int
+	for i := 0; i < len(tokens); i++ {
+		for _, q := range clauses {
+			if n := matchAt(tokens, i, q); n > 0 {
+				matches = append(matches, [2]int{tokens[i].start, tokens[i+n-1].end})
+				i += n - 1
+				break
+			}
+		}
+	}
+
+	result := make([]string, 0, maxSnippets)
+	for i := 0; i < len(matches) && len(result) < maxSnippets; {
+		from := runeStart(text, matches[i][0]-snippetContext)
+		to := runeStart(text, matches[i][1]+snippetContext)
+		var b strings.Builder
+		if from > 0 {
+			b.WriteString("…")
+		}
+		last := from
+		// Every match that fits in the window is highlighted in the same snippet
+		for ; i < len(matches) && matches[i][1] <= to; i++ {
+			b.WriteString(html.EscapeString(text[last:matches[i][0]]))
+			b.WriteString(HighlightStart + html.EscapeString(text[matches[i][0]:matches[i][1]]) + HighlightEnd)
+			last = matches[i][1]
+		}
+		b.WriteString(html.EscapeString(text[last:to]))
+		if to < len(text) {
+			b.WriteString("…")
+		}
+		result = append(result, b.String())
+	}
+	return result
+}
+
+// matchAt returns the number of tokens a clause matches starting at tokens[i], or 0
+func matchAt(tokens []token, i int, q queryClause) int {
+	if i+len(q.terms) > len(tokens) {
+		return 0
+	}
+	for k, term := range q.terms {
+		t := tokens[i+k].term
+		if q.prefix && k == len(q.terms)-1 {
+			if !strings.HasPrefix(t, term) {
+				return 0
+			}
+		} else if t != term {
+			return 0
+		}
+	}
+	return len(q.terms)
+}
+
+// runeStart clamps i to the text and moves it back to the start of a rune
+func runeStart(text string, i int) int {
+	if i <= 0 {
+		return 0
+	}
+	if i >= len(text) {
+		return len(text)
+	}
+	for i > 0 && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"path/filepath"
+	"seg-red-broker/internal/app/client/clienttest"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/kms"
+	"seg-red-broker/internal/app/store"
+	"testing"
+)
+
+func newTestSearchService(t *testing.T) (*FileServiceImpl, *clienttest.FileService, *SearchServiceImpl) {
+	t.Helper()
+	fs, backend := newTestFileService(t)
+	ss := NewSearchService(fs, store.NewSearchStore())
+	fs.AddListener(ss)
+	return fs, backend, ss
+}
+
+func searchDocIDs(t *testing.T, ss *SearchServiceImpl, query string) []string {
+	t.Helper()
+	results, err := ss.Search("ana", query, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docIDs := make([]string, 0, len(results))
+	for _, result := range results {
+		docIDs = append(docIDs, result.DocID)
+	}
+	return docIDs
+}
+
+func TestSearchRebuildFindsDocumentsWithoutMetadata(t *testing.T) {
+	fs, backend, ss := newTestSearchService(t)
+	// Stored before the broker kept metadata, and so before it indexed anything
+	backend.Put("ana", "legacy", "the old harbour")
+	if _, err := fs.CreateFile("ana", "new", &dao.Document{Content: []byte("the new harbour")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.Rebuild("ana"); err != nil {
+		t.Fatal(err)
+	}
+	if docIDs := searchDocIDs(t, ss, "harbour"); len(docIDs) != 2 {
+		t.Fatalf("search found %v, want both documents", docIDs)
+	}
+	if err := fs.DeleteFile("ana", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if docIDs := searchDocIDs(t, ss, "harbour"); len(docIDs) != 1 || docIDs[0] != "legacy" {
+		t.Fatalf("search found %v once a document is deleted, want legacy", docIDs)
+	}
+}
+
+func TestSearchLeavesOutEncryptedDocuments(t *testing.T) {
+	fs, _, ss := newTestSearchService(t)
+	if _, err := fs.CreateFile("ana", "plain", &dao.Document{Content: []byte("secret plans")}); err != nil {
+		t.Fatal(err)
+	}
+	k, err := kms.NewLocalKMS(filepath.Join(t.TempDir(), "keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.kms = k
+	if _, err := fs.CreateFile("ana", "sealed", &dao.Document{Content: []byte("secret plans")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.CreateFile("ana", "own-key", &dao.Document{Content: []byte("secret plans"), CustomerKey: make([]byte, 32)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.Rebuild("ana"); err != nil {
+		t.Fatal(err)
+	}
+	if docIDs := searchDocIDs(t, ss, "secret"); len(docIDs) != 1 || docIDs[0] != "plain" {
+		t.Fatalf("search found %v, want only the document stored in plain text", docIDs)
+	}
+}
+
+func TestSearchSnippetsAreEscaped(t *testing.T) {
+	fs, _, ss := newTestSearchService(t)
+	if _, err := fs.CreateFile("ana", "page", &dao.Document{Content: []byte("<script>alert(1)</script> payload")}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := ss.Search("ana", "payload", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || len(results[0].Snippets) != 1 {
+		t.Fatalf("results %+v, want one snippet", results)
+	}
+	if want := "&lt;script&gt;alert(1)&lt;/script&gt; " + HighlightStart + "payload" + HighlightEnd; results[0].Snippets[0] != want {
+		t.Fatalf("snippet %q, want %q", results[0].Snippets[0], want)
+	}
+}
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Transfer operations
+const (
+	TransferMove = "move"
+	TransferCopy = "copy"
+)
+
+type TransferServiceImpl struct {
+	fs FileService
+}
+
+func NewTransferService(fs FileService) *TransferServiceImpl {
+	return &TransferServiceImpl{fs: fs}
+}
+
+type TransferService interface {
+	Move(username, docID string, req dao.TransferRequest, customerKey []byte) (*dao.TransferResult, error)
+	Copy(username, docID string, req dao.TransferRequest, customerKey []byte) (*dao.TransferResult, error)
+}
+
+// Move copies a document to its destination and then removes it. The file service cannot move
+// documents, so if the removal fails the destination is put back as it was before the move.
+func (svc *TransferServiceImpl) Move(username, docID string, req dao.TransferRequest, customerKey []byte) (*dao.TransferResult, error) {
+	return svc.transfer(TransferMove, username, docID, req, customerKey)
+}
+
+// Copy writes the content of a document under another doc ID
+func (svc *TransferServiceImpl) Copy(username, docID string, req dao.TransferRequest, customerKey []byte) (*dao.TransferResult, error) {
+	return svc.transfer(TransferCopy, username, docID, req, customerKey)
+}
+
+func (svc *TransferServiceImpl) transfer(op, username, docID string, req dao.TransferRequest, customerKey []byte) (*dao.TransferResult, error) {
+	if req.Conflict == "" {
+		req.Conflict = ConflictFail
+	}
+	switch req.Conflict {
+	case ConflictFail, ConflictOverwrite, ConflictRename:
+	default:
+		return nil, common.BadRequestError("conflict must be fail, overwrite or rename")
+	}
+	if req.Destination == "" {
+		return nil, common.EmptyParamsError("destination")
+	}
+	dest, apiErr := NormalizeDocID(req.Destination)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if dest == docID {
+		return nil, common.BadRequestError("source and destination are the same document")
+	}
+
+	doc, err := svc.fs.GetFileWithKey(username, docID, customerKey)
+	if err != nil {
+		return nil, err
+	}
+	// The previous destination is kept to put it back if a move cannot be completed
+	previous, err := svc.existing(username, dest, customerKey)
+	if err != nil {
+		return nil, err
+	}
+	if previous != nil {
+		switch req.Conflict {
+		case ConflictFail:
+			return nil, common.ConflictError("document " + dest + " already exists")
+		case ConflictRename:
+			docs, err := svc.fs.GetUserDocSizes(username)
+			if err != nil {
+				return nil, err
+			}
+			taken := make(map[string]bool, len(docs))
+			for id := range docs {
+				taken[id] = true
+			}
+			dest, previous = renameDocID(dest, taken), nil
+		}
+	}
+
+	// The tags and labels go along, replacing those of an overwritten destination
+	copied := &dao.Document{
+		Content:     doc.Content,
+		Metadata:    dao.FileMetadata{ContentType: doc.Metadata.ContentType, Tags: doc.Metadata.Tags, Labels: doc.Metadata.Labels},
+		CustomerKey: customerKey,
+	}
+	if copied.Metadata.Tags == nil {
+		copied.Metadata.Tags = make([]string, 0)
+	}
+	if copied.Metadata.Labels == nil {
+		copied.Metadata.Labels = make(map[string]string)
+	}
+	var size *dao.FileSize
+	if previous != nil {
+		size, err = svc.fs.UpdateFile(username, dest, copied)
+	} else {
+		size, err = svc.fs.CreateFile(username, dest, copied)
+	}
+	// Nothing has changed yet if writing the destination fails
+	if err != nil {
+		return nil, err
+	}
+
+	if op == TransferMove {
+		if err := svc.fs.RemoveFile(username, docID); err != nil {
+			return nil, svc.rollback(username, docID, dest, previous, customerKey, err)
+		}
+	}
+	return &dao.TransferResult{Operation: op, Source: docID, Destination: dest, Overwritten: previous != nil, Size: size.Size}, nil
+}
+
+// existing returns the document at a destination, or nil if there is none
+func (svc *TransferServiceImpl) existing(username, docID string, customerKey []byte) (*dao.Document, error) {
+	doc, err := svc.fs.GetFileWithKey(username, docID, customerKey)
+	if err != nil && common.ToAPIError(err).StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	return doc, err
+}
+
+// rollback undoes the write of the destination of a move whose source could not be deleted,
+// reporting in the error whether both documents are now as they were before the move
+func (svc *TransferServiceImpl) rollback(username, docID, dest string, previous *dao.Document, customerKey []byte, cause error) error {
+	failure := &dao.TransferFailure{
+		Operation:   TransferMove,
+		Source:      docID,
+		Destination: dest,
+		FailedStep:  "delete source",
+		Error:       common.PublicError(cause),
+	}
+	var err error
+	if previous != nil {
+		restored := &dao.Document{Content: previous.Content, Metadata: previous.Metadata, CustomerKey: customerKey}
+		_, err = svc.fs.UpdateFile(username, dest, restored)
+	} else {
+		err = svc.fs.RemoveFile(username, dest)
+	}
+	if err != nil {
+		log.Errorf("Error rolling back the move of %s/%s to %s: %v", username, docID, dest, err)
+		failure.RollbackError = common.PublicError(err)
+		return &common.APIError{
+			StatusCode: http.StatusInternalServerError,
+			Err:        cause,
+			Message:    "move failed and could not be rolled back, both the source and the destination exist",
+			Details:    failure,
+		}
+	}
+	failure.RolledBack = true
+	return &common.APIError{
+		StatusCode: failure.Error.StatusCode,
+		Err:        cause,
+		Message:    "move failed deleting the source, the destination was rolled back",
+		Details:    failure,
+	}
+}
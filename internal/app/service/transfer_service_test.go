@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"testing"
+)
+
+// transferFailure returns the details of a move that failed after writing its destination
+func transferFailure(t *testing.T, err error) (*common.APIError, *dao.TransferFailure) {
+	t.Helper()
+	var apiErr *common.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("move returned %v, want an APIError", err)
+	}
+	failure, ok := apiErr.Details.(*dao.TransferFailure)
+	if !ok {
+		t.Fatalf("move returned %+v, want the details of the failure", apiErr)
+	}
+	return apiErr, failure
+}
+
+func TestTransfer(t *testing.T) {
+	fs, _ := newTestFileService(t)
+	svc := NewTransferService(fs)
+	for docID, content := range map[string]string{"a": "A", "b": "B"} {
+		if _, err := fs.CreateFile("ana", docID, &dao.Document{Content: []byte(content), Metadata: dao.FileMetadata{Tags: []string{docID}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := svc.Move("ana", "a", dao.TransferRequest{Destination: "b"}, nil)
+	if err == nil || common.ToAPIError(err).StatusCode != http.StatusConflict {
+		t.Fatalf("moving onto an existing document returned %v, want 409", err)
+	}
+	result, err := svc.Copy("ana", "a", dao.TransferRequest{Destination: "b", Conflict: ConflictRename}, nil)
+	if err != nil || result.Destination != "b-1" {
+		t.Fatalf("copy renamed to %+v (%v), want b-1", result, err)
+	}
+	result, err = svc.Move("ana", "a", dao.TransferRequest{Destination: "b", Conflict: ConflictOverwrite}, nil)
+	if err != nil || !result.Overwritten {
+		t.Fatalf("move returned %+v (%v), want b overwritten", result, err)
+	}
+	if _, err := fs.GetFile("ana", "a"); err == nil {
+		t.Fatal("the source of the move is still there")
+	}
+	doc, err := fs.GetFile("ana", "b")
+	if err != nil || string(doc.Content) != "A" || len(doc.Metadata.Tags) != 1 || doc.Metadata.Tags[0] != "a" {
+		t.Fatalf("b is %+v (%v) after the move, want the content and tags of a", doc, err)
+	}
+}
+
+func TestMoveRollback(t *testing.T) {
+	fs, backend := newTestFileService(t)
+	svc := NewTransferService(fs)
+	for docID, content := range map[string]string{"src": "source", "dst": "previous"} {
+		if _, err := fs.CreateFile("ana", docID, &dao.Document{Content: []byte(content)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backend.Fail(http.MethodDelete, "ana", "src", http.StatusServiceUnavailable)
+
+	// An overwritten destination is put back as it was
+	_, err := svc.Move("ana", "src", dao.TransferRequest{Destination: "dst", Conflict: ConflictOverwrite}, nil)
+	apiErr, failure := transferFailure(t, err)
+	if !failure.RolledBack || failure.FailedStep != "delete source" || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("failure %+v with status %d, want it rolled back", failure, apiErr.StatusCode)
+	}
+	if doc, err := fs.GetFile("ana", "dst"); err != nil || string(doc.Content) != "previous" {
+		t.Fatalf("dst is %v (%v) after the rollback, want its previous content", doc, err)
+	}
+
+	// A new destination is removed
+	_, err = svc.Move("ana", "src", dao.TransferRequest{Destination: "new"}, nil)
+	if _, failure = transferFailure(t, err); !failure.RolledBack {
+		t.Fatalf("failure %+v, want it rolled back", failure)
+	}
+	if _, ok := backend.Stored("ana", "new"); ok {
+		t.Fatal("the destination of the failed move is still there")
+	}
+
+	// When the rollback fails too, both documents are reported to exist
+	backend.Fail(http.MethodDelete, "ana", "other", http.StatusServiceUnavailable)
+	_, err = svc.Move("ana", "src", dao.TransferRequest{Destination: "other"}, nil)
+	apiErr, failure = transferFailure(t, err)
+	if failure.RolledBack || failure.RollbackError == nil || apiErr.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("failure %+v with status %d, want the rollback error", failure, apiErr.StatusCode)
+	}
+
+	backend.Recover()
+	if doc, err := fs.GetFile("ana", "src"); err != nil || string(doc.Content) != "source" {
+		t.Fatalf("src is %v (%v) after the failed moves, want it untouched", doc, err)
+	}
+}
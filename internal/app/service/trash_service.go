@@ -0,0 +1,292 @@
+package service
+
+import (
+	"net/http"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/store"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TrashPrefix starts the doc IDs the contents of trashed documents are kept under in the file
+// service, followed by the trash entry ID. They are flat, as the file service routes on single
+// path segments, and users cannot write there, NormalizeDocID rejects them.
+const TrashPrefix = "_trash-"
+
+// TrashListener is told about the documents moved to the trash and those leaving it, purged or
+// restored. FileDeleted is called too for a document moved to the trash, as for any deletion.
+type TrashListener interface {
+	FileTrashed(username string, item dao.TrashItem)
+	TrashRemoved(username string, item dao.TrashItem)
+}
+
+type TrashServiceImpl struct {
+	fs        *FileServiceImpl
+	ts        *store.TrashStore
+	retention time.Duration
+}
+
+// NewTrashService creates a TrashService keeping deleted documents for TRASH_RETENTION, 0 meaning forever
+func NewTrashService(fs *FileServiceImpl, ts *store.TrashStore) *TrashServiceImpl {
+	svc := &TrashServiceImpl{
+		fs:        fs,
+		ts:        ts,
+		retention: common.GetEnvDuration("TRASH_RETENTION", 30*24*time.Hour),
+	}
+	go svc.purgeEvery(common.GetEnvDuration("TRASH_PURGE_INTERVAL", time.Hour))
+	return svc
+}
+
+type TrashService interface {
+	List(username string) []dao.TrashItem
+	Restore(username, id, conflict string) (*dao.TrashItem, error)
+	Purge(username, id string) error
+	Empty(username string) (int, error)
+	PurgeExpired() error
+}
+
+// List returns the documents in the trash of a user, the most recently deleted first
+func (svc *TrashServiceImpl) List(username string) []dao.TrashItem {
+	entries := svc.ts.List(username)
+	items := make([]dao.TrashItem, len(entries))
+	for i, entry := range entries {
+		items[i] = svc.item(entry)
+	}
+	return items
+}
+
+// Restore puts a trashed document back under its doc ID. The stored content is moved back as
+// it is, it stays encrypted for that doc ID. A document written there since can be overwritten.
+func (svc *TrashServiceImpl) Restore(username, id, conflict string) (*dao.TrashItem, error) {
+	if conflict == "" {
+		conflict = ConflictFail
+	}
+	if conflict != ConflictFail && conflict != ConflictOverwrite {
+		return nil, common.BadRequestError("conflict must be fail or overwrite")
+	}
+	entry, ok := svc.ts.Get(username, id)
+	if !ok {
+		return nil, common.NotFoundError("trash entry " + id + " not found")
+	}
+	unlock := svc.fs.lockDocument(username, entry.DocID)
+	defer unlock()
+	_, exists := svc.fs.ms.Get(username, entry.DocID)
+	if exists && conflict == ConflictFail {
+		return nil, common.ConflictError("document " + entry.DocID + " already exists")
+	}
+	stored, err := svc.fs.fc.GetFile(username, TrashPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Claiming the entry first keeps a concurrent restore or purge from using it too
+	if claimed, err := svc.ts.Delete(username, id); err != nil || !claimed {
+		if err == nil {
+			err = common.NotFoundError("trash entry " + id + " not found")
+		}
+		return nil, err
+	}
+	// The trashed copy stops counting against the quota the restored document is checked against
+	svc.fs.notifyTrashRemoved(username, entry.TrashItem)
+	content, meta, err := svc.restore(username, entry, stored.Content, exists)
+	if err != nil {
+		svc.unclaim(username, *entry)
+		svc.fs.notifyTrashed(username, entry.TrashItem)
+		return nil, err
+	}
+	if err := svc.fs.fc.DeleteFile(username, TrashPrefix+id); err != nil {
+		log.Errorf("Error removing the trashed content of %s/%s: %v", username, entry.DocID, err)
+	}
+
+	svc.fs.notifyWritten(username, entry.DocID, &dao.Document{Content: content, Metadata: meta}, !exists)
+	item := entry.TrashItem
+	return &item, nil
+}
+
+// restore writes a trashed content back under its doc ID. The document is validated again,
+// quotas and scanning policies may have changed since.
+func (svc *TrashServiceImpl) restore(username string, entry *dao.TrashEntry, stored string, exists bool) ([]byte, dao.FileMetadata, error) {
+	meta := entry.Metadata
+	if expired(&meta) {
+		// Restoring a document is keeping it, whatever its expiry was
+		meta.ExpiresAt = nil
+	}
+	var content []byte
+	if meta.Encryption == nil || !meta.Encryption.CustomerKey {
+		var err error
+		if content, err = svc.fs.decodeContent(username, entry.DocID, stored, meta, nil); err != nil {
+			return nil, meta, err
+		}
+		doc := &dao.Document{Content: content, Metadata: meta}
+		if err := svc.fs.validate(username, entry.DocID, doc); err != nil {
+			return nil, meta, err
+		}
+		meta.Scan = doc.Metadata.Scan
+	}
+	var err error
+	if exists {
+		_, err = svc.fs.fc.UpdateFile(username, entry.DocID, []byte(stored))
+	} else {
+		_, err = svc.fs.fc.CreateFile(username, entry.DocID, []byte(stored))
+	}
+	if err == nil {
+		err = svc.fs.ms.Put(username, entry.DocID, meta)
+	}
+	return content, meta, err
+}
+
+// Purge deletes a trashed document for good
+func (svc *TrashServiceImpl) Purge(username, id string) error {
+	entry, ok := svc.ts.Get(username, id)
+	if !ok {
+		return common.NotFoundError("trash entry " + id + " not found")
+	}
+	return svc.purge(username, *entry)
+}
+
+// Empty purges every document in the trash of a user, returning how many were purged
+func (svc *TrashServiceImpl) Empty(username string) (int, error) {
+	purged := 0
+	for _, entry := range svc.ts.List(username) {
+		if err := svc.purge(username, entry); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// PurgeExpired purges the documents kept in the trash for longer than the retention period
+func (svc *TrashServiceImpl) PurgeExpired() error {
+	if svc.retention <= 0 {
+		return nil
+	}
+	purged := 0
+	cutoff := time.Now().UTC().Add(-svc.retention)
+	for _, username := range svc.ts.Usernames() {
+		for _, entry := range svc.ts.List(username) {
+			if entry.DeletedAt.After(cutoff) {
+				continue
+			}
+			if err := svc.purge(username, entry); err != nil {
+				return err
+			}
+			purged++
+		}
+	}
+	if purged > 0 {
+		log.Infof("Purged %d documents from the trash", purged)
+	}
+	return nil
+}
+
+// put moves a document to the trash: its stored content is copied as it is to the trash folder
+// before it is deleted, so that encrypted documents are trashed without being decrypted
+func (svc *TrashServiceImpl) put(username, docID string) error {
+	stored, err := svc.fs.fc.GetFile(username, docID)
+	if err != nil {
+		return err
+	}
+	meta, ok := svc.fs.ms.Get(username, docID)
+	if !ok {
+		meta = &dao.FileMetadata{Size: len(stored.Content)}
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	entry := dao.TrashEntry{
+		TrashItem: dao.TrashItem{
+			ID:          id,
+			DocID:       docID,
+			Size:        meta.Size,
+			ContentType: meta.ContentType,
+			DeletedAt:   time.Now().UTC(),
+		},
+		Metadata: *meta,
+	}
+
+	if _, err := svc.fs.fc.CreateFile(username, TrashPrefix+id, []byte(stored.Content)); err != nil {
+		return err
+	}
+	if err := svc.ts.Put(username, entry); err != nil {
+		svc.discard(username, id)
+		return err
+	}
+	if err := svc.fs.fc.DeleteFile(username, docID); err != nil {
+		// The document is still there, the copy in the trash is not needed
+		if _, err := svc.ts.Delete(username, id); err != nil {
+			log.Error("Error removing trash entry: ", err)
+		}
+		svc.discard(username, id)
+		return err
+	}
+	if err := svc.fs.ms.Delete(username, docID); err != nil {
+		return err
+	}
+	svc.fs.notifyTrashed(username, entry.TrashItem)
+	return nil
+}
+
+func (svc *TrashServiceImpl) purge(username string, entry dao.TrashEntry) error {
+	if claimed, err := svc.ts.Delete(username, entry.ID); err != nil || !claimed {
+		return err
+	}
+	err := svc.fs.fc.DeleteFile(username, TrashPrefix+entry.ID)
+	if err != nil && common.ToAPIError(err).StatusCode != http.StatusNotFound {
+		// The entry is kept so that purging it can be tried again
+		svc.unclaim(username, entry)
+		return err
+	}
+	svc.fs.notifyTrashRemoved(username, entry.TrashItem)
+	return nil
+}
+
+// unclaim puts back an entry claimed by a restore or purge that failed
+func (svc *TrashServiceImpl) unclaim(username string, entry dao.TrashEntry) {
+	if err := svc.ts.Put(username, entry); err != nil {
+		log.Errorf("Error putting back trash entry %s of %s: %v", entry.ID, username, err)
+	}
+}
+
+// discard removes a trashed content that has no entry
+func (svc *TrashServiceImpl) discard(username, id string) {
+	if err := svc.fs.fc.DeleteFile(username, TrashPrefix+id); err != nil {
+		log.Errorf("Error removing trashed content %s of %s: %v", id, username, err)
+	}
+}
+
+func (fs *FileServiceImpl) notifyTrashed(username string, item dao.TrashItem) {
+	for _, l := range fs.listeners {
+		if tl, ok := l.(TrashListener); ok {
+			tl.FileTrashed(username, item)
+		}
+	}
+}
+
+func (fs *FileServiceImpl) notifyTrashRemoved(username string, item dao.TrashItem) {
+	for _, l := range fs.listeners {
+		if tl, ok := l.(TrashListener); ok {
+			tl.TrashRemoved(username, item)
+		}
+	}
+}
+
+func (svc *TrashServiceImpl) item(entry dao.TrashEntry) dao.TrashItem {
+	item := entry.TrashItem
+	if svc.retention > 0 {
+		purgeAt := item.DeletedAt.Add(svc.retention)
+		item.PurgeAt = &purgeAt
+	}
+	return item
+}
+
+func (svc *TrashServiceImpl) purgeEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := svc.PurgeExpired(); err != nil {
+			log.Error("Error purging the trash: ", err)
+		}
+	}
+}
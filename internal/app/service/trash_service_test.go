@@ -0,0 +1,119 @@
+package service
+
+import (
+	"seg-red-broker/internal/app/client/clienttest"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/store"
+	"strings"
+	"testing"
+)
+
+func newTestTrash(t *testing.T) (*FileServiceImpl, *clienttest.FileService, *TrashServiceImpl, *QuotaServiceImpl) {
+	t.Helper()
+	fs, backend := newTestFileService(t)
+	trash := NewTrashService(fs, store.NewTrashStore())
+	fs.EnableTrash(trash)
+	qs := NewQuotaService(fs, store.NewUsageStore(), store.NewQuotaStore())
+	qs.EnableTrash(trash)
+	fs.AddValidator(qs)
+	fs.AddListener(qs)
+	return fs, backend, trash, qs
+}
+
+func usedBytes(t *testing.T, qs *QuotaServiceImpl, username string) (int64, int64) {
+	t.Helper()
+	usage, err := qs.GetUsage(username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return usage.Bytes, usage.TrashBytes
+}
+
+func TestTrashRoundTrip(t *testing.T) {
+	fs, backend, trash, qs := newTestTrash(t)
+	if _, err := fs.CreateFile("ana", "todo", &dao.Document{Content: []byte("0123456789")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteFile("ana", "todo"); err != nil {
+		t.Fatal(err)
+	}
+	items := trash.List("ana")
+	if len(items) != 1 {
+		t.Fatalf("trash holds %d items, want 1", len(items))
+	}
+	id := items[0].ID
+	// The file service only routes on single path segments
+	if strings.Contains(id, PathSeparator) {
+		t.Fatalf("trash ID %q is not flat", id)
+	}
+	if _, ok := backend.Stored("ana", TrashPrefix+id); !ok {
+		t.Fatal("the trashed content is not kept by the file service")
+	}
+	if bytes, trashBytes := usedBytes(t, qs, "ana"); bytes != 10 || trashBytes != 10 {
+		t.Fatalf("usage of a trashed document: %d bytes, %d in the trash, want 10 and 10", bytes, trashBytes)
+	}
+
+	if _, err := trash.Restore("ana", id, ""); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := fs.GetFile("ana", "todo")
+	if err != nil || string(doc.Content) != "0123456789" {
+		t.Fatalf("restored document: %v, %v", doc, err)
+	}
+	if _, ok := backend.Stored("ana", TrashPrefix+id); ok {
+		t.Fatal("the trashed content is left behind after the restore")
+	}
+	if bytes, trashBytes := usedBytes(t, qs, "ana"); bytes != 10 || trashBytes != 0 {
+		t.Fatalf("usage of a restored document: %d bytes, %d in the trash, want 10 and 0", bytes, trashBytes)
+	}
+}
+
+func TestTrashPurgeReleasesQuota(t *testing.T) {
+	fs, backend, trash, qs := newTestTrash(t)
+	qs.defaults.MaxBytes = 15
+	if _, err := fs.CreateFile("ana", "a", &dao.Document{Content: []byte("0123456789")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteFile("ana", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.CreateFile("ana", "b", &dao.Document{Content: []byte("0123456789")}); err == nil {
+		t.Fatal("the bytes in the trash were not counted against the quota")
+	}
+
+	id := trash.List("ana")[0].ID
+	if err := trash.Purge("ana", id); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := backend.Stored("ana", TrashPrefix+id); ok {
+		t.Fatal("the purged content is left in the file service")
+	}
+	if _, err := fs.CreateFile("ana", "b", &dao.Document{Content: []byte("0123456789")}); err != nil {
+		t.Fatalf("writing once the trash is purged: %v", err)
+	}
+}
+
+func TestTrashReconcile(t *testing.T) {
+	fs, _, _, qs := newTestTrash(t)
+	if _, err := fs.CreateFile("ana", "a", &dao.Document{Content: []byte("0123456789")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.CreateFile("ana", "b", &dao.Document{Content: []byte("01234")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteFile("ana", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := qs.Reconcile("ana"); err != nil {
+		t.Fatal(err)
+	}
+	if bytes, trashBytes := usedBytes(t, qs, "ana"); bytes != 15 || trashBytes != 10 {
+		t.Fatalf("reconciled usage: %d bytes, %d in the trash, want 15 and 10", bytes, trashBytes)
+	}
+}
+
+func TestNormalizeDocIDReservesTrash(t *testing.T) {
+	if _, err := NormalizeDocID(TrashPrefix + "0123"); err == nil {
+		t.Fatal("a doc ID of the trash was accepted")
+	}
+}
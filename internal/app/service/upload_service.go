@@ -0,0 +1,174 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/store"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type UploadServiceImpl struct {
+	fs         FileService
+	us         *store.UploadStore
+	expiration time.Duration
+	maxLength  int64
+	locks      keyLock
+}
+
+// NewUploadService creates an UploadService and starts the cleanup of abandoned sessions
+func NewUploadService(fs FileService, us *store.UploadStore) *UploadServiceImpl {
+	svc := &UploadServiceImpl{
+		fs:         fs,
+		us:         us,
+		expiration: common.GetEnvDuration("UPLOAD_EXPIRATION", 24*time.Hour),
+		maxLength:  common.GetEnvInt64("UPLOAD_MAX_LENGTH", 1<<30),
+	}
+	go svc.cleanup(common.GetEnvDuration("UPLOAD_CLEANUP_INTERVAL", time.Hour))
+	return svc
+}
+
+type UploadService interface {
+	CreateUpload(username, docID, contentType string, length int64) (*dao.UploadSession, error)
+	GetUpload(username, uploadID string) (*dao.UploadSession, error)
+	WriteChunk(username, uploadID string, offset int64, chunk io.Reader) (*dao.UploadSession, error)
+	DeleteUpload(username, uploadID string) error
+	PurgeExpired() error
+}
+
+// CreateUpload opens a session for a document of the given length
+func (svc *UploadServiceImpl) CreateUpload(username, docID, contentType string, length int64) (*dao.UploadSession, error) {
+	if length < 0 {
+		return nil, common.BadRequestError("invalid upload length")
+	}
+	if length > svc.maxLength {
+		return nil, common.PayloadTooLargeError("upload length exceeds the maximum allowed")
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	session := &dao.UploadSession{
+		ID:          hex.EncodeToString(id),
+		Username:    username,
+		DocID:       docID,
+		ContentType: contentType,
+		Length:      length,
+		ExpiresAt:   time.Now().UTC().Add(svc.expiration),
+	}
+	if err := svc.us.Create(session); err != nil {
+		return nil, err
+	}
+	// Empty documents are complete as soon as they are announced
+	if length == 0 {
+		return session, svc.assemble(session)
+	}
+	return session, nil
+}
+
+// GetUpload returns the session of a user, reporting its current offset
+func (svc *UploadServiceImpl) GetUpload(username, uploadID string) (*dao.UploadSession, error) {
+	session, err := svc.us.Get(uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || session.Username != username || time.Now().After(session.ExpiresAt) {
+		return nil, common.NotFoundError("upload not found")
+	}
+	return session, nil
+}
+
+// WriteChunk appends a chunk starting at offset. A chunk going past the upload length is
+// rejected whole. Once every byte has been received the document is created through the
+// FileService and the session is removed.
+func (svc *UploadServiceImpl) WriteChunk(username, uploadID string, offset int64, chunk io.Reader) (*dao.UploadSession, error) {
+	unlock := svc.lock(uploadID)
+	defer unlock()
+
+	session, err := svc.GetUpload(username, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	if offset != session.Offset {
+		return nil, common.ConflictError("upload offset does not match the current offset")
+	}
+
+	session.ExpiresAt = time.Now().UTC().Add(svc.expiration)
+	err = svc.us.Append(session, chunk, session.Length-session.Offset)
+	if errors.Is(err, store.ErrUploadLengthExceeded) {
+		return nil, common.PayloadTooLargeError("chunk exceeds the upload length, none of it was kept")
+	}
+	if err != nil {
+		log.Warnf("Upload %s interrupted at offset %d: %v", session.ID, session.Offset, err)
+		return nil, common.BadRequestError("upload interrupted, resume from the current offset")
+	}
+	if session.Offset < session.Length {
+		return session, nil
+	}
+	return session, svc.assemble(session)
+}
+
+// DeleteUpload aborts a session and discards its staged bytes
+func (svc *UploadServiceImpl) DeleteUpload(username, uploadID string) error {
+	unlock := svc.lock(uploadID)
+	defer unlock()
+
+	if _, err := svc.GetUpload(username, uploadID); err != nil {
+		return err
+	}
+	return svc.us.Delete(uploadID)
+}
+
+// PurgeExpired removes the sessions that have not received any chunk before their expiration
+func (svc *UploadServiceImpl) PurgeExpired() error {
+	sessions, err := svc.us.List()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, session := range sessions {
+		if now.Before(session.ExpiresAt) {
+			continue
+		}
+		unlock := svc.lock(session.ID)
+		err := svc.us.Delete(session.ID)
+		unlock()
+		if err != nil {
+			return err
+		}
+		log.Infof("Purged expired upload %s of %s", session.ID, session.Username)
+	}
+	return nil
+}
+
+// assemble creates the document out of the staged bytes. On failure the session is kept
+// so that the client can retry by sending an empty chunk at the final offset.
+func (svc *UploadServiceImpl) assemble(session *dao.UploadSession) error {
+	content, err := svc.us.ReadContent(session.ID)
+	if err != nil {
+		return err
+	}
+	doc := &dao.Document{Content: content, Metadata: dao.FileMetadata{ContentType: session.ContentType}}
+	if _, err := svc.fs.CreateFile(session.Username, session.DocID, doc); err != nil {
+		return err
+	}
+	return svc.us.Delete(session.ID)
+}
+
+func (svc *UploadServiceImpl) cleanup(interval time.Duration) {
+	for range time.Tick(interval) {
+		if err := svc.PurgeExpired(); err != nil {
+			log.Error("Error purging expired uploads: ", err)
+		}
+	}
+}
+
+// lock serialises the operations on a session
+func (svc *UploadServiceImpl) lock(uploadID string) func() {
+	return svc.locks.lock(uploadID)
+}
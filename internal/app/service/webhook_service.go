@@ -0,0 +1,413 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/store"
+	"strconv"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Types of the document events delivered to webhooks, WebhookEventAll subscribes to all of them
+const (
+	EventDocumentCreated = "document.created"
+	EventDocumentUpdated = "document.updated"
+	EventDocumentDeleted = "document.deleted"
+	EventDocumentLabeled = "document.labeled"
+	WebhookEventAll      = "*"
+)
+
+var webhookEvents = map[string]bool{
+	EventDocumentCreated: true, EventDocumentUpdated: true, EventDocumentDeleted: true, EventDocumentLabeled: true, WebhookEventAll: true,
+}
+
+// Statuses of webhook deliveries
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Headers of the webhook deliveries. The signature is "sha256=" and the hex HMAC-SHA256, keyed
+// with the secret of the webhook, of the timestamp, a dot and the body.
+const (
+	HeaderWebhookDelivery  = "X-Webhook-Delivery"
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+type WebhookServiceImpl struct {
+	ws     *store.WebhookStore
+	client *http.Client
+	// maxAttempts deliveries are attempted, backoff apart doubling after every attempt
+	maxAttempts int
+	backoff     time.Duration
+	// allowPrivate lets webhooks reach loopback and private addresses, which are refused otherwise
+	allowPrivate bool
+}
+
+// NewWebhookService creates a WebhookService and resumes the deliveries that were pending
+func NewWebhookService(ws *store.WebhookStore) *WebhookServiceImpl {
+	svc := &WebhookServiceImpl{
+		ws:           ws,
+		maxAttempts:  int(common.GetEnvInt64("WEBHOOK_MAX_ATTEMPTS", 5)),
+		backoff:      common.GetEnvDuration("WEBHOOK_RETRY_BACKOFF", 10*time.Second),
+		allowPrivate: os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true",
+	}
+	svc.client = svc.newClient(common.GetEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second))
+	if svc.maxAttempts < 1 {
+		svc.maxAttempts = 1
+	}
+	for username, deliveries := range ws.Pending() {
+		for _, delivery := range deliveries {
+			go svc.deliver(username, delivery)
+		}
+	}
+	return svc
+}
+
+type WebhookService interface {
+	FileListener
+	LabelListener
+	Subscribe(username string, req dao.WebhookRequest) (*dao.Webhook, error)
+	List(username string) []dao.Webhook
+	Unsubscribe(username, id string) error
+	Deliveries(username, webhookID string) ([]dao.WebhookDelivery, error)
+	Replay(username, webhookID, deliveryID string) (*dao.WebhookDelivery, error)
+}
+
+// FileWritten emits every document write, whichever request or service made it
+func (svc *WebhookServiceImpl) FileWritten(username, docID string, doc *dao.Document, created bool) {
+	eventType := EventDocumentUpdated
+	if created {
+		eventType = EventDocumentCreated
+	}
+	size := doc.Metadata.Size
+	svc.emit(username, eventType, docID, &size)
+}
+
+func (svc *WebhookServiceImpl) FileDeleted(username, docID string) {
+	svc.emit(username, EventDocumentDeleted, docID, nil)
+}
+
+func (svc *WebhookServiceImpl) LabelsSet(username, docID string, _ *dao.DocumentLabels) {
+	svc.emit(username, EventDocumentLabeled, docID, nil)
+}
+
+// Subscribe creates a webhook receiving the events of a user
+func (svc *WebhookServiceImpl) Subscribe(username string, req dao.WebhookRequest) (*dao.Webhook, error) {
+	target, err := url.Parse(req.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, common.BadRequestError("url must be an absolute http or https URL")
+	}
+	// Host names are checked when delivering, once resolved
+	if ip := net.ParseIP(target.Hostname()); ip != nil && !svc.allowPrivate && !isPublicIP(ip) {
+		return nil, common.BadRequestError("url must not point to a loopback, private or reserved address")
+	}
+	events := make([]string, 0, len(req.Events))
+	for _, event := range req.Events {
+		if !webhookEvents[event] {
+			return nil, common.BadRequestError("unknown event " + event)
+		}
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		events = append(events, WebhookEventAll)
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	secret := req.Secret
+	if secret == "" {
+		if secret, err = randomHex(32); err != nil {
+			return nil, err
+		}
+	}
+	webhook := dao.Webhook{ID: id, URL: target.String(), Events: events, Secret: secret, CreatedAt: time.Now().UTC()}
+	if err := svc.ws.Put(username, webhook); err != nil {
+		return nil, err
+	}
+	log.Infof("Webhook %s of %s subscribed to %v", id, username, events)
+	return &webhook, nil
+}
+
+// List returns the webhooks of a user without their secrets
+func (svc *WebhookServiceImpl) List(username string) []dao.Webhook {
+	webhooks := svc.ws.List(username)
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks
+}
+
+// Unsubscribe deletes a webhook, its pending deliveries are given up
+func (svc *WebhookServiceImpl) Unsubscribe(username, id string) error {
+	found, err := svc.ws.Delete(username, id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return common.NotFoundError("webhook not found")
+	}
+	return nil
+}
+
+// Deliveries returns the logged deliveries of a webhook, the most recent first
+func (svc *WebhookServiceImpl) Deliveries(username, webhookID string) ([]dao.WebhookDelivery, error) {
+	if _, ok := svc.ws.Get(username, webhookID); !ok {
+		return nil, common.NotFoundError("webhook not found")
+	}
+	deliveries := make([]dao.WebhookDelivery, 0)
+	for _, delivery := range svc.ws.Deliveries(username) {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries, nil
+}
+
+// Replay delivers the event of a logged delivery again, as a new delivery
+func (svc *WebhookServiceImpl) Replay(username, webhookID, deliveryID string) (*dao.WebhookDelivery, error) {
+	webhook, ok := svc.ws.Get(username, webhookID)
+	if !ok {
+		return nil, common.NotFoundError("webhook not found")
+	}
+	original, ok := svc.ws.GetDelivery(username, deliveryID)
+	if !ok || original.WebhookID != webhookID {
+		return nil, common.NotFoundError("delivery not found")
+	}
+	delivery, err := svc.enqueue(username, webhook, original.Event)
+	if err != nil {
+		return nil, err
+	}
+	delivery.ReplayOf = original.ID
+	if err := svc.ws.PutDelivery(username, *delivery); err != nil {
+		return nil, err
+	}
+	go svc.deliver(username, *delivery)
+	return delivery, nil
+}
+
+// emit delivers a document event to the webhooks of the user subscribed to it. The size is
+// that of the document written, nil otherwise. Deliveries happen in the background.
+func (svc *WebhookServiceImpl) emit(username, eventType, docID string, size *int) {
+	webhooks := svc.ws.List(username)
+	if len(webhooks) == 0 {
+		return
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		log.Error("Error creating webhook event: ", err)
+		return
+	}
+	event := dao.WebhookEvent{ID: id, Type: eventType, Username: username, DocID: docID, OccurredAt: time.Now().UTC()}
+	if size != nil {
+		event.Size = size
+	}
+
+	for i := range webhooks {
+		if !subscribed(&webhooks[i], eventType) {
+			continue
+		}
+		delivery, err := svc.enqueue(username, &webhooks[i], event)
+		if err == nil {
+			err = svc.ws.PutDelivery(username, *delivery)
+		}
+		if err != nil {
+			log.Errorf("Error logging the delivery of %s to webhook %s: %v", eventType, webhooks[i].ID, err)
+			continue
+		}
+		go svc.deliver(username, *delivery)
+	}
+}
+
+func subscribed(webhook *dao.Webhook, eventType string) bool {
+	for _, event := range webhook.Events {
+		if event == eventType || event == WebhookEventAll {
+			return true
+		}
+	}
+	return false
+}
+
+func (svc *WebhookServiceImpl) enqueue(username string, webhook *dao.Webhook, event dao.WebhookEvent) (*dao.WebhookDelivery, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	return &dao.WebhookDelivery{
+		ID:            id,
+		WebhookID:     webhook.ID,
+		URL:           webhook.URL,
+		Event:         event,
+		Status:        DeliveryPending,
+		CreatedAt:     now,
+		NextAttemptAt: &now,
+	}, nil
+}
+
+// deliver attempts a delivery until it succeeds or runs out of attempts, logging every attempt
+func (svc *WebhookServiceImpl) deliver(username string, delivery dao.WebhookDelivery) {
+	for delivery.NextAttemptAt != nil {
+		time.Sleep(time.Until(*delivery.NextAttemptAt))
+		webhook, ok := svc.ws.Get(username, delivery.WebhookID)
+		if !ok {
+			delivery.Status, delivery.Error, delivery.NextAttemptAt = DeliveryFailed, "webhook deleted", nil
+		} else {
+			svc.attempt(webhook, &delivery)
+		}
+		if err := svc.ws.PutDelivery(username, delivery); err != nil {
+			log.Errorf("Error logging webhook delivery %s: %v", delivery.ID, err)
+		}
+	}
+}
+
+// attempt posts the event of a delivery and schedules the next attempt if it fails
+func (svc *WebhookServiceImpl) attempt(webhook *dao.Webhook, delivery *dao.WebhookDelivery) {
+	delivery.Attempts++
+	delivery.ResponseStatus, delivery.Error = 0, ""
+	err := svc.post(webhook, delivery)
+	if err == nil {
+		now := time.Now().UTC()
+		delivery.Status, delivery.DeliveredAt, delivery.NextAttemptAt = DeliverySucceeded, &now, nil
+		log.Debugf("Delivered %s %s to webhook %s", delivery.Event.Type, delivery.Event.DocID, webhook.ID)
+		return
+	}
+
+	delivery.Error = err.Error()
+	if delivery.Attempts >= svc.maxAttempts {
+		delivery.Status, delivery.NextAttemptAt = DeliveryFailed, nil
+		log.Warnf("Giving up delivery %s to webhook %s after %d attempts: %v", delivery.ID, webhook.ID, delivery.Attempts, err)
+		return
+	}
+	next := time.Now().UTC().Add(svc.backoff << (delivery.Attempts - 1))
+	delivery.NextAttemptAt = &next
+	log.Infof("Delivery %s to webhook %s failed, retrying at %s: %v", delivery.ID, webhook.ID, next.Format(time.RFC3339), err)
+}
+
+func (svc *WebhookServiceImpl) post(webhook *dao.Webhook, delivery *dao.WebhookDelivery) error {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookDelivery, delivery.ID)
+	req.Header.Set(HeaderWebhookEvent, delivery.Event.Type)
+	req.Header.Set(HeaderWebhookTimestamp, timestamp)
+	req.Header.Set(HeaderWebhookSignature, "sha256="+SignWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := svc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	delivery.ResponseStatus = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("webhook responded " + resp.Status)
+	}
+	return nil
+}
+
+// newClient creates the client of the deliveries. It only connects to public addresses, checked
+// once the host name is resolved so that no name can point it at the network of the broker,
+// and does not follow redirects, which could lead anywhere.
+func (svc *WebhookServiceImpl) newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !svc.allowPrivate {
+		dialer.Control = publicOnly
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, address)
+			},
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// publicOnly is called with the resolved address of every connection the client makes
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return errors.New("webhook address " + host + " is not public")
+	}
+	return nil
+}
+
+// reservedNets are the ranges besides the loopback, private, link-local, multicast and
+// unspecified ones that are not publicly routable
+var reservedNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",     // This network
+		"100.64.0.0/10", // Shared address space of carrier-grade NAT
+		"192.0.0.0/24",  // IETF protocol assignments
+		"198.18.0.0/15", // Benchmarking
+		"240.0.0.0/4",   // Reserved, broadcast included
+		"64:ff9b::/96",  // NAT64, which maps IPv4 addresses of any kind
+		"2001:db8::/32", // Documentation
+	} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// isPublicIP tells whether an address is publicly routable. IPv4-mapped IPv6 addresses are
+// checked as the IPv4 addresses they map.
+func isPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, n := range reservedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// SignWebhook returns the hex HMAC-SHA256 receivers check the deliveries against
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"seg-red-broker/internal/app/dao"
+	"seg-red-broker/internal/app/store"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeReceiver records the deliveries it gets, failing the first failures of them
+type fakeReceiver struct {
+	mu       sync.Mutex
+	failures int
+	received []receivedDelivery
+}
+
+type receivedDelivery struct {
+	at     time.Time
+	header http.Header
+	body   []byte
+}
+
+func (r *fakeReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received = append(r.received, receivedDelivery{at: time.Now(), header: req.Header, body: body})
+	if len(r.received) <= r.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (r *fakeReceiver) deliveries() []receivedDelivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedDelivery(nil), r.received...)
+}
+
+// newTestWebhookService creates a WebhookService retrying 3 times, 50ms apart at first, allowed
+// to reach the loopback addresses of the test servers
+func newTestWebhookService(t *testing.T) *WebhookServiceImpl {
+	t.Helper()
+	t.Setenv("DATA_FOLDER", t.TempDir())
+	t.Setenv("WEBHOOK_TIMEOUT", "2s")
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+	t.Setenv("WEBHOOK_RETRY_BACKOFF", "50ms")
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	return NewWebhookService(store.NewWebhookStore())
+}
+
+func subscribeTestWebhook(t *testing.T, svc *WebhookServiceImpl, receiver http.Handler) *dao.Webhook {
+	t.Helper()
+	srv := httptest.NewServer(receiver)
+	t.Cleanup(srv.Close)
+	webhook, err := svc.Subscribe("ana", dao.WebhookRequest{URL: srv.URL, Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webhook
+}
+
+// settled waits for the deliveries of a webhook to be neither pending nor retried
+func settled(t *testing.T, svc *WebhookServiceImpl, webhookID string, n int) []dao.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := svc.Deliveries("ana", webhookID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := len(deliveries) == n
+		for _, delivery := range deliveries {
+			done = done && delivery.Status != DeliveryPending
+		}
+		if done {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("deliveries %+v did not settle", deliveries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	svc := newTestWebhookService(t)
+	receiver := &fakeReceiver{}
+	webhook := subscribeTestWebhook(t, svc, receiver)
+
+	svc.emit("ana", EventDocumentCreated, "doc", intPtr(5))
+	deliveries := settled(t, svc, webhook.ID, 1)
+	if deliveries[0].Status != DeliverySucceeded || deliveries[0].ResponseStatus != http.StatusNoContent {
+		t.Fatalf("delivery %+v, want a success", deliveries[0])
+	}
+
+	got := receiver.deliveries()[0]
+	timestamp := got.header.Get(HeaderWebhookTimestamp)
+	if want := "sha256=" + SignWebhook("s3cret", timestamp, got.body); got.header.Get(HeaderWebhookSignature) != want {
+		t.Fatalf("signature %q, want %q", got.header.Get(HeaderWebhookSignature), want)
+	}
+	if got.header.Get(HeaderWebhookDelivery) != deliveries[0].ID || got.header.Get(HeaderWebhookEvent) != EventDocumentCreated {
+		t.Fatalf("delivery headers %v", got.header)
+	}
+	var event dao.WebhookEvent
+	if err := json.Unmarshal(got.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.DocID != "doc" || event.Size == nil || *event.Size != 5 {
+		t.Fatalf("event %+v, want doc of 5 bytes", event)
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	svc := newTestWebhookService(t)
+	receiver := &fakeReceiver{failures: 2}
+	webhook := subscribeTestWebhook(t, svc, receiver)
+
+	svc.emit("ana", EventDocumentUpdated, "doc", intPtr(1))
+	deliveries := settled(t, svc, webhook.ID, 1)
+	if deliveries[0].Status != DeliverySucceeded || deliveries[0].Attempts != 3 {
+		t.Fatalf("delivery %+v, want a success at the third attempt", deliveries[0])
+	}
+	got := receiver.deliveries()
+	if len(got) != 3 {
+		t.Fatalf("received %d attempts, want 3", len(got))
+	}
+	// The backoff doubles after every attempt
+	if gap := got[1].at.Sub(got[0].at); gap < 50*time.Millisecond {
+		t.Errorf("second attempt %s after the first, want 50ms at least", gap)
+	}
+	if gap := got[2].at.Sub(got[1].at); gap < 100*time.Millisecond {
+		t.Errorf("third attempt %s after the second, want 100ms at least", gap)
+	}
+	if got[0].header.Get(HeaderWebhookDelivery) != got[2].header.Get(HeaderWebhookDelivery) {
+		t.Error("the retries are not the same delivery")
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	svc := newTestWebhookService(t)
+	receiver := &fakeReceiver{failures: 10}
+	webhook := subscribeTestWebhook(t, svc, receiver)
+
+	svc.emit("ana", EventDocumentDeleted, "doc", nil)
+	deliveries := settled(t, svc, webhook.ID, 1)
+	delivery := deliveries[0]
+	if delivery.Status != DeliveryFailed || delivery.Attempts != 3 || delivery.ResponseStatus != http.StatusServiceUnavailable {
+		t.Fatalf("delivery %+v, want a failure after 3 attempts", delivery)
+	}
+	if delivery.Error == "" || delivery.NextAttemptAt != nil {
+		t.Fatalf("delivery %+v, want an error and no next attempt", delivery)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := len(receiver.deliveries()); n != 3 {
+		t.Fatalf("received %d attempts, want 3", n)
+	}
+}
+
+func TestWebhookDeliveryLogAndReplay(t *testing.T) {
+	svc := newTestWebhookService(t)
+	receiver := &fakeReceiver{failures: 3}
+	webhook := subscribeTestWebhook(t, svc, receiver)
+	other := subscribeTestWebhook(t, svc, &fakeReceiver{})
+
+	svc.emit("ana", EventDocumentCreated, "doc", intPtr(1))
+	original := settled(t, svc, webhook.ID, 1)[0]
+	if original.Status != DeliveryFailed {
+		t.Fatalf("delivery %+v, want a failure", original)
+	}
+	if deliveries := settled(t, svc, other.ID, 1); deliveries[0].WebhookID != other.ID {
+		t.Fatalf("deliveries of another webhook %+v", deliveries)
+	}
+
+	replay, err := svc.Replay("ana", webhook.ID, original.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.ID == original.ID || replay.ReplayOf != original.ID || replay.Event.ID != original.Event.ID {
+		t.Fatalf("replay %+v, want a new delivery of the event of %s", replay, original.ID)
+	}
+	deliveries := settled(t, svc, webhook.ID, 2)
+	if deliveries[0].ID != replay.ID || deliveries[0].Status != DeliverySucceeded {
+		t.Fatalf("log %+v, want the successful replay first", deliveries)
+	}
+	if _, err := svc.Replay("ana", other.ID, original.ID); err == nil {
+		t.Fatal("replayed the delivery of another webhook")
+	}
+}
+
+func TestWebhookRefusesPrivateAddresses(t *testing.T) {
+	svc := newTestWebhookService(t)
+	receiver := &fakeReceiver{}
+	webhook := subscribeTestWebhook(t, svc, receiver)
+	svc.allowPrivate = false
+	svc.client = svc.newClient(2 * time.Second)
+
+	for _, url := range []string{"http://127.0.0.1/hook", "http://[::1]:8080/hook", "http://169.254.169.254/latest", "http://10.0.0.1/"} {
+		if _, err := svc.Subscribe("ana", dao.WebhookRequest{URL: url}); err == nil {
+			t.Errorf("subscribed %s", url)
+		}
+	}
+	// The address is checked again when connecting, whatever the URL names
+	svc.emit("ana", EventDocumentCreated, "doc", intPtr(1))
+	deliveries := settled(t, svc, webhook.ID, 1)
+	if deliveries[0].Status != DeliveryFailed || len(receiver.deliveries()) != 0 {
+		t.Fatalf("delivery %+v to a loopback address, want a failure", deliveries[0])
+	}
+}
+
+func TestWebhookRefusesRedirects(t *testing.T) {
+	svc := newTestWebhookService(t)
+	target := &fakeReceiver{}
+	srv := httptest.NewServer(target)
+	t.Cleanup(srv.Close)
+	webhook := subscribeTestWebhook(t, svc, http.RedirectHandler(srv.URL, http.StatusTemporaryRedirect))
+
+	svc.emit("ana", EventDocumentCreated, "doc", intPtr(1))
+	deliveries := settled(t, svc, webhook.ID, 1)
+	if deliveries[0].Status != DeliveryFailed || deliveries[0].ResponseStatus != http.StatusTemporaryRedirect {
+		t.Fatalf("redirected delivery %+v, want a failure", deliveries[0])
+	}
+	if n := len(target.deliveries()); n != 0 {
+		t.Fatalf("the redirect was followed %d times", n)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for address, public := range map[string]bool{
+		"93.184.216.34":        true,
+		"2606:4700::6810:84e5": true,
+		"127.0.0.1":            false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"100.64.0.1":           false,
+		"0.0.0.0":              false,
+		"255.255.255.255":      false,
+		"224.0.0.1":            false,
+		"::1":                  false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+		"::ffff:127.0.0.1":     false,
+		"64:ff9b::a00:1":       false,
+	} {
+		if got := isPublicIP(net.ParseIP(address)); got != public {
+			t.Errorf("isPublicIP(%s) = %v, want %v", address, got, public)
+		}
+	}
+}
+
+func TestWebhookEmitsEveryWrite(t *testing.T) {
+	fs, _, trash, _ := newTestTrash(t)
+	svc := NewWebhookService(store.NewWebhookStore())
+	svc.allowPrivate = true
+	svc.client = svc.newClient(2 * time.Second)
+	fs.AddListener(svc)
+	receiver := &fakeReceiver{}
+	webhook := subscribeTestWebhook(t, svc, receiver)
+
+	if _, err := fs.CreateFile("ana", "doc", &dao.Document{Content: []byte(`{"a":1}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewPatchService(fs).Patch("ana", "doc", PatchTypeMerge, []byte(`{"b":2}`), "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SetLabels("ana", "doc", &dao.DocumentLabels{Tags: []string{"draft"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.DeleteFile("ana", "doc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trash.Restore("ana", trash.List("ana")[0].ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	settled(t, svc, webhook.ID, 5)
+	events := make(map[string]int)
+	for _, got := range receiver.deliveries() {
+		var event dao.WebhookEvent
+		if err := json.Unmarshal(got.body, &event); err != nil {
+			t.Fatal(err)
+		}
+		events[event.Type]++
+	}
+	want := map[string]int{EventDocumentCreated: 2, EventDocumentUpdated: 1, EventDocumentLabeled: 1, EventDocumentDeleted: 1}
+	if len(events) != len(want) {
+		t.Fatalf("events %v, want %v", events, want)
+	}
+	for eventType, n := range want {
+		if events[eventType] != n {
+			t.Errorf("events %v, want %v", events, want)
+		}
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
@@ -0,0 +1,254 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"seg-red-broker/internal/app/dao"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// auditGenesis is the PrevHash of the first entry of an audit log
+var auditGenesis = strings.Repeat("0", 64)
+
+// maxAuditLine is the longest audit log line read back
+const maxAuditLine = 1 << 20
+
+// minAuditKey is the shortest key the audit log is chained with
+const minAuditKey = 32
+
+// AuditStore appends the audit entries, one JSON object per line, to a local file that is
+// never rewritten. Every entry is chained to the previous one by its hash, keyed if the
+// store has a key.
+type AuditStore struct {
+	mu   sync.Mutex
+	path string
+	key  []byte
+	seq  uint64
+	head string
+}
+
+// NewAuditStore creates an AuditStore continuing the log at AuditLogPath, chained with the key
+// of AuditKey
+func NewAuditStore() *AuditStore {
+	key, err := AuditKey()
+	if err != nil {
+		log.Fatal("Error loading audit key: ", err)
+	}
+	if key == nil {
+		log.Warn("AUDIT_KEYFILE is not set, whoever can write the audit log can also rewrite its hash chain")
+	}
+	s := &AuditStore{path: AuditLogPath(), key: key, head: auditGenesis}
+	var last *dao.AuditEntry
+	err = scanAuditLog(s.path, -1, func(line int, entry *dao.AuditEntry) error {
+		s.seq, s.head, last = entry.Seq, entry.Hash, entry
+		return nil
+	})
+	if err != nil {
+		log.Error("Error loading audit log: ", err)
+	}
+	// The chain goes on from the last entry, which has to be chained with the same key
+	if last != nil && AuditHash(key, *last) != last.Hash {
+		log.Error("The last entry of the audit log does not match its hash, the log is tampered or chained with another key")
+	}
+	return s
+}
+
+// AuditKey returns the key the audit log is chained with, read from AUDIT_KEYFILE, nil if it is
+// not set. The keyfile has to be kept outside the data folder, or whoever could rewrite the log
+// could also rewrite the chain.
+func AuditKey() ([]byte, error) {
+	path := os.Getenv("AUDIT_KEYFILE")
+	if path == "" {
+		return nil, nil
+	}
+	keyfile, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := filepath.Abs(dataFolder())
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(data, keyfile); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, errors.New("the audit keyfile must be kept outside the data folder")
+	}
+	key, err := os.ReadFile(keyfile)
+	if err != nil {
+		return nil, err
+	}
+	key = bytes.TrimSpace(key)
+	if len(key) < minAuditKey {
+		return nil, fmt.Errorf("the audit key must be %d bytes at least", minAuditKey)
+	}
+	return key, nil
+}
+
+// AuditLogPath returns the path of the audit log, AUDIT_LOG_FILE or audit.log in the data folder
+func AuditLogPath() string {
+	if path := os.Getenv("AUDIT_LOG_FILE"); path != "" {
+		return path
+	}
+	return filepath.Join(dataFolder(), "audit.log")
+}
+
+// Append chains an entry to the log and writes it
+func (s *AuditStore) Append(entry dao.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry.Seq, entry.PrevHash = s.seq+1, s.head
+	entry.Hash = AuditHash(s.key, entry)
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	s.seq, s.head = entry.Seq, entry.Hash
+	return nil
+}
+
+// Query returns the last limit entries match selects, the most recent first. It reads the log
+// as it was when called, without holding up the entries appended meanwhile.
+func (s *AuditStore) Query(match func(entry *dao.AuditEntry) bool, limit int) ([]dao.AuditEntry, error) {
+	// Entries are appended whole under the lock, so the size then ends with a complete entry
+	s.mu.Lock()
+	info, err := os.Stat(s.path)
+	s.mu.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return make([]dao.AuditEntry, 0), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]dao.AuditEntry, 0)
+	err = scanAuditLog(s.path, info.Size(), func(line int, entry *dao.AuditEntry) error {
+		if match(entry) {
+			entries = append(entries, *entry)
+			if len(entries) > limit {
+				entries = entries[1:]
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// AuditHash returns the hex HMAC-SHA256 of an entry without its own hash, keyed with key, or
+// its plain SHA-256 if key is nil
+func AuditHash(key []byte, entry dao.AuditEntry) string {
+	entry.Hash = ""
+	data, _ := json.Marshal(entry)
+	if key == nil {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyAuditLog checks that the entries of the audit log at path are numbered in order and
+// that each hash matches the entry, keyed with key, and chains to the previous one. Any entry
+// that has been edited, removed or inserted breaks the chain from there on. Without the key,
+// the chain can be rewritten from the edited entry on, so only a keyed log proves anything.
+func VerifyAuditLog(path string, key []byte) (*dao.AuditVerification, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	result := &dao.AuditVerification{Valid: true, Keyed: key != nil, Head: auditGenesis}
+	var seq uint64
+	err := scanAuditLog(path, -1, func(line int, entry *dao.AuditEntry) error {
+		switch {
+		case entry.Seq != seq+1:
+			return fmt.Errorf("entry %d follows entry %d", entry.Seq, seq)
+		case entry.PrevHash != result.Head:
+			return errors.New("previous hash does not match")
+		case AuditHash(key, *entry) != entry.Hash:
+			return errors.New("hash does not match the entry")
+		}
+		seq, result.Head = entry.Seq, entry.Hash
+		result.Entries++
+		return nil
+	})
+	var lineErr *auditLineError
+	if errors.As(err, &lineErr) {
+		result.Valid, result.Line, result.Error = false, lineErr.line, lineErr.err.Error()
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type auditLineError struct {
+	line int
+	err  error
+}
+
+func (e *auditLineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+// scanAuditLog calls fn with the entries in the first size bytes of the log at path in order,
+// all of them if size is negative. A missing log has none.
+func scanAuditLog(path string, size int64, fn func(line int, entry *dao.AuditEntry) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if size >= 0 {
+		r = io.LimitReader(f, size)
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxAuditLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var entry dao.AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return &auditLineError{line: line, err: err}
+		}
+		if err := fn(line, &entry); err != nil {
+			return &auditLineError{line: line, err: err}
+		}
+	}
+	return scanner.Err()
+}
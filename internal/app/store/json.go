@@ -0,0 +1,45 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// dataFolder returns the folder where the broker keeps its local state
+func dataFolder() string {
+	folder := os.Getenv("DATA_FOLDER")
+	if folder == "" {
+		folder = "data"
+	}
+	return folder
+}
+
+// loadJSON reads the JSON file at path into v. A missing file leaves v untouched.
+func loadJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// saveJSON atomically replaces the file at path with the JSON encoding of v
+func saveJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
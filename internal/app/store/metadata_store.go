@@ -0,0 +1,130 @@
+package store
+
+import (
+	"path/filepath"
+	"seg-red-broker/internal/app/dao"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// MetadataStore keeps the broker-side metadata of every document, persisted as a local JSON file
+type MetadataStore struct {
+	mu   sync.RWMutex
+	path string
+	docs map[string]map[string]dao.FileMetadata
+}
+
+// NewMetadataStore creates a MetadataStore loaded from the data folder
+func NewMetadataStore() *MetadataStore {
+	s := &MetadataStore{
+		path: filepath.Join(dataFolder(), "metadata.json"),
+		docs: make(map[string]map[string]dao.FileMetadata),
+	}
+	if err := loadJSON(s.path, &s.docs); err != nil {
+		log.Error("Error loading metadata store: ", err)
+	}
+	return s
+}
+
+// Get returns the metadata of a document, if any
+func (s *MetadataStore) Get(username, docID string) (*dao.FileMetadata, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	meta, ok := s.docs[username][docID]
+	if !ok {
+		return nil, false
+	}
+	return &meta, true
+}
+
+// Put stores the metadata of a document
+func (s *MetadataStore) Put(username, docID string, meta dao.FileMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.docs[username] == nil {
+		s.docs[username] = make(map[string]dao.FileMetadata)
+	}
+	s.docs[username][docID] = meta
+	return saveJSON(s.path, s.docs)
+}
+
+// Delete removes the metadata of a document
+func (s *MetadataStore) Delete(username, docID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.docs[username][docID]; !ok {
+		return nil
+	}
+	delete(s.docs[username], docID)
+	if len(s.docs[username]) == 0 {
+		delete(s.docs, username)
+	}
+	return saveJSON(s.path, s.docs)
+}
+
+// List returns a copy of the metadata of every document of a user
+func (s *MetadataStore) List(username string) map[string]dao.FileMetadata {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	docs := make(map[string]dao.FileMetadata, len(s.docs[username]))
+	for docID, meta := range s.docs[username] {
+		docs[docID] = meta
+	}
+	return docs
+}
+
+// Usernames returns every user with documents
+func (s *MetadataStore) Usernames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	usernames := make([]string, 0, len(s.docs))
+	for username := range s.docs {
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// Update changes the metadata of an existing document with fn, which can return false to leave
+// it as it is. Holding the lock during fn keeps concurrent writes from being overwritten.
+func (s *MetadataStore) Update(username, docID string, fn func(meta *dao.FileMetadata) bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta, ok := s.docs[username][docID]
+	if !ok || !fn(&meta) {
+		return nil
+	}
+	s.docs[username][docID] = meta
+	return saveJSON(s.path, s.docs)
+}
+
+// CountKeyReferences reads the metadata and the trash of the data folder and counts the
+// documents whose data key is wrapped with the master key keyID. Unlike the stores, it fails
+// when a file cannot be read, as a missed reference would make a document unreadable.
+func CountKeyReferences(keyID string) (int, error) {
+	var docs map[string]map[string]dao.FileMetadata
+	if err := loadJSON(filepath.Join(dataFolder(), "metadata.json"), &docs); err != nil {
+		return 0, err
+	}
+	var trash map[string]map[string]dao.TrashEntry
+	if err := loadJSON(filepath.Join(dataFolder(), "trash.json"), &trash); err != nil {
+		return 0, err
+	}
+	n := 0
+	uses := func(meta dao.FileMetadata) {
+		if meta.Encryption != nil && meta.Encryption.KeyID == keyID {
+			n++
+		}
+	}
+	for _, metas := range docs {
+		for _, meta := range metas {
+			uses(meta)
+		}
+	}
+	for _, entries := range trash {
+		for _, entry := range entries {
+			uses(entry.Metadata)
+		}
+	}
+	return n, nil
+}
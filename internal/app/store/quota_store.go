@@ -0,0 +1,44 @@
+package store
+
+import (
+	"path/filepath"
+	"seg-red-broker/internal/app/dao"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// QuotaStore holds the per-user quota overrides, read from a quotas.json file in the data folder
+// mapping usernames to quotas. The file is maintained by the operator.
+type QuotaStore struct {
+	mu        sync.RWMutex
+	path      string
+	overrides map[string]dao.Quota
+}
+
+// NewQuotaStore creates a QuotaStore loaded from the data folder
+func NewQuotaStore() *QuotaStore {
+	s := &QuotaStore{path: filepath.Join(dataFolder(), "quotas.json")}
+	s.Reload()
+	return s
+}
+
+// Reload reads the overrides again, keeping the current ones if the file is invalid
+func (s *QuotaStore) Reload() {
+	overrides := make(map[string]dao.Quota)
+	if err := loadJSON(s.path, &overrides); err != nil {
+		log.Error("Error loading quota overrides: ", err)
+		return
+	}
+	s.mu.Lock()
+	s.overrides = overrides
+	s.mu.Unlock()
+}
+
+// Get returns the override of a user, if any
+func (s *QuotaStore) Get(username string) (dao.Quota, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	q, ok := s.overrides[username]
+	return q, ok
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"path/filepath"
+	"seg-red-broker/internal/app/dao"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// SchemaStore keeps the JSON Schemas attached by every user, persisted as a local JSON file
+type SchemaStore struct {
+	mu      sync.RWMutex
+	path    string
+	schemas map[string]map[string]dao.DocumentSchema
+}
+
+// NewSchemaStore creates a SchemaStore loaded from the data folder
+func NewSchemaStore() *SchemaStore {
+	s := &SchemaStore{
+		path:    filepath.Join(dataFolder(), "schemas.json"),
+		schemas: make(map[string]map[string]dao.DocumentSchema),
+	}
+	if err := loadJSON(s.path, &s.schemas); err != nil {
+		log.Error("Error loading schema store: ", err)
+	}
+	return s
+}
+
+// List returns the schemas of a user sorted by ID
+func (s *SchemaStore) List(username string) []dao.DocumentSchema {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	schemas := make([]dao.DocumentSchema, 0, len(s.schemas[username]))
+	for _, schema := range s.schemas[username] {
+		schemas = append(schemas, schema)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].ID < schemas[j].ID })
+	return schemas
+}
+
+// Put stores a schema of a user
+func (s *SchemaStore) Put(username string, schema dao.DocumentSchema) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.schemas[username] == nil {
+		s.schemas[username] = make(map[string]dao.DocumentSchema)
+	}
+	s.schemas[username][schema.ID] = schema
+	return saveJSON(s.path, s.schemas)
+}
+
+// Delete removes a schema of a user, reporting whether it existed
+func (s *SchemaStore) Delete(username, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.schemas[username][id]; !ok {
+		return false, nil
+	}
+	delete(s.schemas[username], id)
+	if len(s.schemas[username]) == 0 {
+		delete(s.schemas, username)
+	}
+	return true, saveJSON(s.path, s.schemas)
+}
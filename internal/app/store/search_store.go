@@ -0,0 +1,191 @@
+package store
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"sort"
+	"sync"
+)
+
+// SearchStore persists the search index of every user as a local JSON snapshot plus a
+// journal of the changes made since, which is folded into the snapshot once it grows.
+// Callers serialise the operations on the same user, the store only guards its cache.
+type SearchStore struct {
+	mu          sync.Mutex
+	folder      string
+	journalSize int
+	indexes     map[string]*dao.SearchIndex
+	journals    map[string]int
+}
+
+// NewSearchStore creates a SearchStore inside the data folder
+func NewSearchStore() *SearchStore {
+	return &SearchStore{
+		folder:      filepath.Join(dataFolder(), "search"),
+		journalSize: int(common.GetEnvInt64("SEARCH_JOURNAL_SIZE", 1000)),
+		indexes:     make(map[string]*dao.SearchIndex),
+		journals:    make(map[string]int),
+	}
+}
+
+// usernames are hex encoded so that they are always safe file names
+func (s *SearchStore) path(username string) string {
+	return filepath.Join(s.folder, hex.EncodeToString([]byte(username))+".json")
+}
+
+func (s *SearchStore) journalPath(username string) string {
+	return filepath.Join(s.folder, hex.EncodeToString([]byte(username))+".journal")
+}
+
+// Load returns the index of a user, and whether it had been built before
+func (s *SearchStore) Load(username string) (*dao.SearchIndex, bool, error) {
+	s.mu.Lock()
+	idx, ok := s.indexes[username]
+	s.mu.Unlock()
+	if ok {
+		return idx, true, nil
+	}
+
+	idx = &dao.SearchIndex{}
+	_, err := os.Stat(s.path(username))
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, false, err
+	}
+	if err := loadJSON(s.path(username), idx); err != nil {
+		return nil, false, err
+	}
+	if idx.Lengths == nil {
+		idx.Lengths = make(map[string]int)
+		idx.Postings = make(map[string]map[string][]int)
+	}
+	n, err := s.replay(username, idx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.indexes[username] = idx
+	s.journals[username] = n
+	return idx, exists, nil
+}
+
+// replay applies the journal of a user to its snapshot and returns the number of changes
+func (s *SearchStore) replay(username string, idx *dao.SearchIndex) (int, error) {
+	file, err := os.Open(s.journalPath(username))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	n := 0
+	dec := json.NewDecoder(bufio.NewReader(file))
+	for dec.More() {
+		var change dao.SearchIndexChange
+		if err := dec.Decode(&change); err != nil {
+			// A change cut short by a crash is the last one, it is dropped
+			break
+		}
+		ApplySearchChange(idx, change)
+		n++
+	}
+	return n, nil
+}
+
+// Apply makes a change to the index of a user and records it in the journal
+func (s *SearchStore) Apply(username string, idx *dao.SearchIndex, change dao.SearchIndexChange) error {
+	ApplySearchChange(idx, change)
+
+	s.mu.Lock()
+	s.indexes[username] = idx
+	s.journals[username]++
+	compact := s.journals[username] >= s.journalSize
+	s.mu.Unlock()
+	if compact {
+		return s.Save(username, idx)
+	}
+
+	line, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.folder, 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.journalPath(username), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+// Save persists the whole index of a user and empties its journal
+func (s *SearchStore) Save(username string, idx *dao.SearchIndex) error {
+	s.mu.Lock()
+	s.indexes[username] = idx
+	s.journals[username] = 0
+	s.mu.Unlock()
+	if err := saveJSON(s.path(username), idx); err != nil {
+		return err
+	}
+	if err := os.Remove(s.journalPath(username)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// ApplySearchChange replaces the entry of a document in an index
+func ApplySearchChange(idx *dao.SearchIndex, change dao.SearchIndexChange) {
+	removeSearchDocument(idx, change.DocID)
+	if change.Postings == nil {
+		return
+	}
+	if idx.Terms == nil {
+		idx.Terms = make(map[string][]string)
+	}
+	terms := make([]string, 0, len(change.Postings))
+	for term, positions := range change.Postings {
+		if idx.Postings[term] == nil {
+			idx.Postings[term] = make(map[string][]int)
+		}
+		idx.Postings[term][change.DocID] = positions
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	idx.Lengths[change.DocID] = change.Length
+	idx.Terms[change.DocID] = terms
+}
+
+func removeSearchDocument(idx *dao.SearchIndex, docID string) {
+	if _, ok := idx.Lengths[docID]; !ok {
+		return
+	}
+	delete(idx.Lengths, docID)
+	terms, ok := idx.Terms[docID]
+	if !ok {
+		// Indexes written before terms were recorded are scanned whole
+		for term := range idx.Postings {
+			terms = append(terms, term)
+		}
+	}
+	delete(idx.Terms, docID)
+	for _, term := range terms {
+		docs := idx.Postings[term]
+		delete(docs, docID)
+		if len(docs) == 0 {
+			delete(idx.Postings, term)
+		}
+	}
+}
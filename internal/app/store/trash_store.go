@@ -0,0 +1,95 @@
+package store
+
+import (
+	"path/filepath"
+	"seg-red-broker/internal/app/dao"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// TrashStore keeps the trash entries of every user, persisted as a local JSON file.
+// The contents of the trashed documents stay in the file service.
+type TrashStore struct {
+	mu      sync.RWMutex
+	path    string
+	entries map[string]map[string]dao.TrashEntry
+}
+
+// NewTrashStore creates a TrashStore loaded from the data folder
+func NewTrashStore() *TrashStore {
+	s := &TrashStore{
+		path:    filepath.Join(dataFolder(), "trash.json"),
+		entries: make(map[string]map[string]dao.TrashEntry),
+	}
+	if err := loadJSON(s.path, &s.entries); err != nil {
+		log.Error("Error loading trash store: ", err)
+	}
+	return s
+}
+
+// List returns the trash entries of a user, the most recently deleted first
+func (s *TrashStore) List(username string) []dao.TrashEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]dao.TrashEntry, 0, len(s.entries[username]))
+	for _, entry := range s.entries[username] {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].DeletedAt.Equal(entries[j].DeletedAt) {
+			return entries[i].DeletedAt.After(entries[j].DeletedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	return entries
+}
+
+// Usernames returns every user with documents in the trash
+func (s *TrashStore) Usernames() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	usernames := make([]string, 0, len(s.entries))
+	for username := range s.entries {
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// Get returns a trash entry, if any
+func (s *TrashStore) Get(username, id string) (*dao.TrashEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.entries[username][id]
+	if !ok {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// Put stores a trash entry
+func (s *TrashStore) Put(username string, entry dao.TrashEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries[username] == nil {
+		s.entries[username] = make(map[string]dao.TrashEntry)
+	}
+	s.entries[username][entry.ID] = entry
+	return saveJSON(s.path, s.entries)
+}
+
+// Delete removes a trash entry. It reports whether the entry existed, so that concurrent
+// restores and purges of the same entry only succeed once.
+func (s *TrashStore) Delete(username, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[username][id]; !ok {
+		return false, nil
+	}
+	delete(s.entries[username], id)
+	if len(s.entries[username]) == 0 {
+		delete(s.entries, username)
+	}
+	return true, saveJSON(s.path, s.entries)
+}
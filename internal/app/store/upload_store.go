@@ -0,0 +1,120 @@
+package store
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"seg-red-broker/internal/app/dao"
+	"strings"
+)
+
+// ErrUploadLengthExceeded is returned by Append for a chunk going past the length of the upload
+var ErrUploadLengthExceeded = errors.New("chunk exceeds the upload length")
+
+// UploadStore stages the chunks of resumable uploads on local disk.
+// Every session is kept as a <id>.json descriptor next to a <id>.part file with the received bytes.
+type UploadStore struct {
+	folder string
+}
+
+// NewUploadStore creates an UploadStore inside the data folder
+func NewUploadStore() *UploadStore {
+	return &UploadStore{folder: filepath.Join(dataFolder(), "uploads")}
+}
+
+func (s *UploadStore) sessionPath(id string) string {
+	return filepath.Join(s.folder, id+".json")
+}
+
+func (s *UploadStore) partPath(id string) string {
+	return filepath.Join(s.folder, id+".part")
+}
+
+// Create stores a new session with no bytes received yet
+func (s *UploadStore) Create(session *dao.UploadSession) error {
+	if err := saveJSON(s.sessionPath(session.ID), session); err != nil {
+		return err
+	}
+	return os.WriteFile(s.partPath(session.ID), nil, 0o600)
+}
+
+// Get returns a session, or nil if it does not exist
+func (s *UploadStore) Get(id string) (*dao.UploadSession, error) {
+	if _, err := os.Stat(s.sessionPath(id)); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	var session dao.UploadSession
+	if err := loadJSON(s.sessionPath(id), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Append writes chunk at the end of the staged content and advances the session offset.
+// Bytes received before a read error are kept, so the client can resume from the new offset.
+// A chunk longer than limit is discarded whole with ErrUploadLengthExceeded.
+func (s *UploadStore) Append(session *dao.UploadSession, chunk io.Reader, limit int64) error {
+	f, err := os.OpenFile(s.partPath(session.ID), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	written, copyErr := io.Copy(f, io.LimitReader(chunk, limit+1))
+	if written > limit {
+		written, copyErr = 0, ErrUploadLengthExceeded
+		if err := f.Truncate(session.Offset); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err := f.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	session.Offset += written
+	if err := saveJSON(s.sessionPath(session.ID), session); err != nil {
+		return err
+	}
+	return copyErr
+}
+
+// ReadContent returns every byte staged for a session
+func (s *UploadStore) ReadContent(id string) ([]byte, error) {
+	return os.ReadFile(s.partPath(id))
+}
+
+// Delete removes a session and its staged bytes
+func (s *UploadStore) Delete(id string) error {
+	if err := os.Remove(s.partPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(s.sessionPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List returns every staged session
+func (s *UploadStore) List() ([]*dao.UploadSession, error) {
+	entries, err := os.ReadDir(s.folder)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*dao.UploadSession
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		session, err := s.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if session != nil {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
@@ -0,0 +1,75 @@
+package store
+
+import (
+	"path/filepath"
+	"seg-red-broker/internal/app/dao"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// UsageStore keeps the storage usage of every user, persisted as a local JSON file
+type UsageStore struct {
+	mu    sync.Mutex
+	path  string
+	usage map[string]*dao.Usage
+}
+
+// NewUsageStore creates a UsageStore loaded from the data folder
+func NewUsageStore() *UsageStore {
+	s := &UsageStore{
+		path:  filepath.Join(dataFolder(), "usage.json"),
+		usage: make(map[string]*dao.Usage),
+	}
+	if err := loadJSON(s.path, &s.usage); err != nil {
+		log.Error("Error loading usage store: ", err)
+	}
+	return s
+}
+
+// Get returns a copy of the usage of a user, if it is tracked
+func (s *UsageStore) Get(username string) (dao.Usage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.usage[username]
+	if !ok {
+		return dao.Usage{}, false
+	}
+	usage := *u
+	usage.Sizes = make(map[string]int, len(u.Sizes))
+	for docID, size := range u.Sizes {
+		usage.Sizes[docID] = size
+	}
+	return usage, true
+}
+
+// Usernames returns every tracked user
+func (s *UsageStore) Usernames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usernames := make([]string, 0, len(s.usage))
+	for username := range s.usage {
+		usernames = append(usernames, username)
+	}
+	return usernames
+}
+
+// Update applies fn to the usage of a user, if it is tracked, and persists the result
+func (s *UsageStore) Update(username string, fn func(u *dao.Usage)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.usage[username]
+	if !ok {
+		return nil
+	}
+	fn(u)
+	return saveJSON(s.path, s.usage)
+}
+
+// Put replaces the usage of a user
+func (s *UsageStore) Put(username string, usage dao.Usage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage[username] = &usage
+	return saveJSON(s.path, s.usage)
+}
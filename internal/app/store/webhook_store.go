@@ -0,0 +1,156 @@
+package store
+
+import (
+	"path/filepath"
+	"seg-red-broker/internal/app/common"
+	"seg-red-broker/internal/app/dao"
+	"sort"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// WebhookStore keeps the webhooks of every user and the log of their deliveries, persisted
+// as local JSON files. Only the last WEBHOOK_DELIVERY_LOG_SIZE deliveries of each user are kept.
+type WebhookStore struct {
+	mu             sync.RWMutex
+	webhooksPath   string
+	deliveriesPath string
+	logSize        int
+	webhooks       map[string]map[string]dao.Webhook
+	deliveries     map[string]map[string]dao.WebhookDelivery
+}
+
+// NewWebhookStore creates a WebhookStore loaded from the data folder
+func NewWebhookStore() *WebhookStore {
+	s := &WebhookStore{
+		webhooksPath:   filepath.Join(dataFolder(), "webhooks.json"),
+		deliveriesPath: filepath.Join(dataFolder(), "webhook_deliveries.json"),
+		logSize:        int(common.GetEnvInt64("WEBHOOK_DELIVERY_LOG_SIZE", 100)),
+		webhooks:       make(map[string]map[string]dao.Webhook),
+		deliveries:     make(map[string]map[string]dao.WebhookDelivery),
+	}
+	if err := loadJSON(s.webhooksPath, &s.webhooks); err != nil {
+		log.Error("Error loading webhook store: ", err)
+	}
+	if err := loadJSON(s.deliveriesPath, &s.deliveries); err != nil {
+		log.Error("Error loading webhook delivery log: ", err)
+	}
+	return s
+}
+
+// List returns the webhooks of a user, the oldest first
+func (s *WebhookStore) List(username string) []dao.Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	webhooks := make([]dao.Webhook, 0, len(s.webhooks[username]))
+	for _, webhook := range s.webhooks[username] {
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks
+}
+
+// Get returns a webhook, if any
+func (s *WebhookStore) Get(username, id string) (*dao.Webhook, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	webhook, ok := s.webhooks[username][id]
+	if !ok {
+		return nil, false
+	}
+	return &webhook, true
+}
+
+// Put stores a webhook
+func (s *WebhookStore) Put(username string, webhook dao.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.webhooks[username] == nil {
+		s.webhooks[username] = make(map[string]dao.Webhook)
+	}
+	s.webhooks[username][webhook.ID] = webhook
+	return saveJSON(s.webhooksPath, s.webhooks)
+}
+
+// Delete removes a webhook, reporting whether it existed. Its deliveries stay in the log.
+func (s *WebhookStore) Delete(username, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[username][id]; !ok {
+		return false, nil
+	}
+	delete(s.webhooks[username], id)
+	if len(s.webhooks[username]) == 0 {
+		delete(s.webhooks, username)
+	}
+	return true, saveJSON(s.webhooksPath, s.webhooks)
+}
+
+// Deliveries returns the logged deliveries of a user, the most recent first
+func (s *WebhookStore) Deliveries(username string) []dao.WebhookDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sortedDeliveries(username)
+}
+
+// Pending returns the deliveries of every user that still have attempts to make, by username
+func (s *WebhookStore) Pending() map[string][]dao.WebhookDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	pending := make(map[string][]dao.WebhookDelivery)
+	for username, deliveries := range s.deliveries {
+		for _, delivery := range deliveries {
+			if delivery.NextAttemptAt != nil {
+				pending[username] = append(pending[username], delivery)
+			}
+		}
+	}
+	return pending
+}
+
+// GetDelivery returns a logged delivery, if any
+func (s *WebhookStore) GetDelivery(username, id string) (*dao.WebhookDelivery, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	delivery, ok := s.deliveries[username][id]
+	if !ok {
+		return nil, false
+	}
+	return &delivery, true
+}
+
+// PutDelivery logs a delivery, dropping the oldest ones of the user beyond the log size
+func (s *WebhookStore) PutDelivery(username string, delivery dao.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deliveries[username] == nil {
+		s.deliveries[username] = make(map[string]dao.WebhookDelivery)
+	}
+	s.deliveries[username][delivery.ID] = delivery
+	if deliveries := s.sortedDeliveries(username); len(deliveries) > s.logSize {
+		for _, old := range deliveries[s.logSize:] {
+			delete(s.deliveries[username], old.ID)
+		}
+	}
+	return saveJSON(s.deliveriesPath, s.deliveries)
+}
+
+func (s *WebhookStore) sortedDeliveries(username string) []dao.WebhookDelivery {
+	deliveries := make([]dao.WebhookDelivery, 0, len(s.deliveries[username]))
+	for _, delivery := range s.deliveries[username] {
+		deliveries = append(deliveries, delivery)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return deliveries
+}